@@ -0,0 +1,159 @@
+package dynamiclog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 可以只为某些请求临时调高日志级别，其余请求仍使用 configmap 中的配置：
+//
+//	ctx = dynamiclog.WithDebugParts(ctx, "part1", "part2")  // 代码中直接标记
+//	ctx = logprint.ContextWithHeaders(ctx, r.Header)        // 按 configmap 中的 rules 标记
+//	logprint.EnableLogPrintContext(ctx, "part1", dynamiclog.LogDebugLevel)
+//
+// rules 只能在结构化格式中配置，header 为 "Name=value" 时要求请求头的某个值等于 value，只有 "Name" 时要求请求头存在：
+//
+//	rules:
+//	  - match: {header: X-Debug-Tenant=acme}
+//	    parts: [part1, part2]   # 为空表示所有 part
+//	    level: debug
+
+// contextLevelKey 是 context 中请求级别日志级别的 key
+type contextLevelKey struct{}
+
+// contextLevel 是标记在 context 中的日志级别，作用于 parts 及其下级，parts 为空时作用于所有 part
+type contextLevel struct {
+	parts []string
+	level int
+}
+
+// contextRule 是 configmap 中 rules 的一项
+type contextRule struct {
+	header   string
+	value    string
+	hasValue bool
+	contextLevel
+}
+
+// RuleConfig 是结构化格式中 rules 的一项，匹配的请求中 Parts 使用 Level
+type RuleConfig struct {
+	Match MatchConfig `json:"match"`
+	Parts []string    `json:"parts,omitempty"`
+	Level string      `json:"level"`
+}
+
+// MatchConfig 描述 rule 匹配的请求
+type MatchConfig struct {
+	Header string `json:"header"` // "Name=value" 或 "Name"，Name 不区分大小写，同时适用于 HTTP 请求头和 gRPC metadata
+}
+
+// WithPartLevel 返回标记了 parts 在该请求中使用 level 的 context，parts 为空时作用于所有 part。
+// 请求级别的日志级别只会让日志更详细：实际生效的是它与 configmap 中的级别中较低的一个
+func WithPartLevel(ctx context.Context, level int, parts ...string) context.Context {
+	prev, _ := ctx.Value(contextLevelKey{}).([]contextLevel)
+	levels := make([]contextLevel, 0, len(prev)+1)
+	levels = append(append(levels, prev...), contextLevel{parts: parts, level: level})
+	return context.WithValue(ctx, contextLevelKey{}, levels)
+}
+
+// WithDebugParts 返回标记了 parts 在该请求中使用 debug 级别的 context
+func WithDebugParts(ctx context.Context, parts ...string) context.Context {
+	return WithPartLevel(ctx, LogDebugLevel, parts...)
+}
+
+// EnableLogPrintContext 与 EnableLogPrint 相同，但会考虑 ctx 中标记的请求级别的日志级别
+func (c *LogController) EnableLogPrintContext(ctx context.Context, partName string, nowLevel int) int {
+	levels := c.cmInfo.load()
+	r := levels.resolve(partName)
+	if level, ok := partLevelFromContext(ctx, partName); ok && level < r.level {
+		r.level = level
+	}
+	if c.enabled(levels, partName, r, nowLevel) {
+		return LogEnable
+	}
+	return LogDisable
+}
+
+// ContextWithHeaders 按 configmap 中的 rules 匹配请求头（http.Header 或 gRPC metadata.MD），返回标记了匹配的 rule 的 context
+func (c *LogController) ContextWithHeaders(ctx context.Context, headers map[string][]string) context.Context {
+	for _, rule := range c.cmInfo.load().rules {
+		if rule.match(headers) {
+			ctx = WithPartLevel(ctx, rule.level, rule.parts...)
+		}
+	}
+	return ctx
+}
+
+// HTTPMiddleware 返回按 configmap 中的 rules 标记请求 context 的 http.Handler
+func HTTPMiddleware(c LogInterface, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(c.ContextWithHeaders(r.Context(), r.Header)))
+	})
+}
+
+// partLevelFromContext 返回 ctx 中作用于 partName 的最低日志级别
+func partLevelFromContext(ctx context.Context, partName string) (int, bool) {
+	levels, _ := ctx.Value(contextLevelKey{}).([]contextLevel)
+	level, found := 0, false
+	for _, l := range levels {
+		if l.covers(partName) && (!found || l.level < level) {
+			level, found = l.level, true
+		}
+	}
+	return level, found
+}
+
+// covers 判断 partName 是否是 parts 中的某一个或其下级
+func (l contextLevel) covers(partName string) bool {
+	if len(l.parts) == 0 {
+		return true
+	}
+	for _, part := range l.parts {
+		if partName == part {
+			return true
+		}
+		if strings.HasPrefix(partName, part) && len(partName) > len(part) && strings.IndexByte(partSeparators, partName[len(part)]) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// match 判断请求头是否匹配 rule，请求头名称不区分大小写
+func (r contextRule) match(headers map[string][]string) bool {
+	for name, values := range headers {
+		if !strings.EqualFold(name, r.header) {
+			continue
+		}
+		if !r.hasValue {
+			return true
+		}
+		for _, v := range values {
+			if v == r.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newContextRule 检查并转换 configmap 中的 rule
+func (cmi *ConfigMapInfo) newContextRule(rc RuleConfig) (contextRule, error) {
+	level, ok := cmi.registry.Parse(rc.Level)
+	if !ok {
+		return contextRule{}, fmt.Errorf("%w %q", ErrUnknownLevel, rc.Level)
+	}
+	name, value, hasValue := strings.Cut(rc.Match.Header, "=")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return contextRule{}, fmt.Errorf("empty header in match")
+	}
+	return contextRule{
+		header:       name,
+		value:        strings.TrimSpace(value),
+		hasValue:     hasValue,
+		contextLevel: contextLevel{parts: rc.Parts, level: level},
+	}, nil
+}
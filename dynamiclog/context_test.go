@@ -0,0 +1,117 @@
+package dynamiclog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithDebugPartsCovers(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl: warn\nctl.a: error\nctlx: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithDebugParts(context.Background(), "ctl")
+	for _, tc := range []struct {
+		part string
+		want int
+	}{
+		{"ctl", LogEnable},
+		{"ctl.a", LogEnable},  // 下级
+		{"ctl/b", LogEnable},  // 其他分隔符
+		{"ctlx", LogDisable},  // 前缀相同但不是下级
+		{"other", LogDisable}, // 默认级别 info
+	} {
+		if got := c.EnableLogPrintContext(ctx, tc.part, LogDebugLevel); got != tc.want {
+			t.Errorf("EnableLogPrintContext(%q, debug) = %d, want %d", tc.part, got, tc.want)
+		}
+	}
+	if got := c.EnableLogPrintContext(context.Background(), "ctl", LogDebugLevel); got != LogDisable {
+		t.Error("debug of ctl is enabled without the request level")
+	}
+	// 请求级别只会让日志更详细
+	if got := c.EnableLogPrintContext(WithPartLevel(context.Background(), LogErrorLevel), "ctl", LogWarnLevel); got != LogEnable {
+		t.Error("request level error hides the warn logs of ctl")
+	}
+	// parts 为空时作用于所有 part
+	if got := c.EnableLogPrintContext(WithDebugParts(context.Background()), "other", LogDebugLevel); got != LogEnable {
+		t.Error("WithDebugParts without parts does not cover other")
+	}
+}
+
+func TestContextWithHeaders(t *testing.T) {
+	c := newTestController()
+	data := `---
+parts:
+  part1: warn
+rules:
+  - {match: {header: X-Debug-Tenant=acme}, parts: [part1], level: debug}
+  - {match: {header: X-Trace}, parts: [part2], level: trace}
+`
+	if err := c.parse(c.sources[0], newTestConfigMap("1", data)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		headers map[string][]string
+		part    string
+		level   int
+		want    int
+	}{
+		{"value matches", map[string][]string{"X-Debug-Tenant": {"acme"}}, "part1", LogDebugLevel, LogEnable},
+		{"name is case-insensitive", map[string][]string{"x-debug-tenant": {"other", "acme"}}, "part1", LogDebugLevel, LogEnable},
+		{"value differs", map[string][]string{"X-Debug-Tenant": {"acme-2"}}, "part1", LogDebugLevel, LogDisable},
+		{"name only", map[string][]string{"X-Trace": {""}}, "part2", LogTraceLevel, LogEnable},
+		{"other parts", map[string][]string{"X-Trace": {"1"}}, "part1", LogDebugLevel, LogDisable},
+		{"no header", nil, "part2", LogTraceLevel, LogDisable},
+	} {
+		ctx := c.ContextWithHeaders(context.Background(), tc.headers)
+		if got := c.EnableLogPrintContext(ctx, tc.part, tc.level); got != tc.want {
+			t.Errorf("%s: EnableLogPrintContext(%q, %d) = %d, want %d", tc.name, tc.part, tc.level, got, tc.want)
+		}
+	}
+}
+
+func TestRuleParseErrors(t *testing.T) {
+	c := newTestController()
+	data := `---
+rules:
+  - {match: {header: X-Debug}, level: dbug}
+  - {match: {header: "=acme"}, level: debug}
+  - {match: {header: X-Trace}, level: trace}
+`
+	if err := c.parse(c.sources[0], newTestConfigMap("1", data)); err != nil {
+		t.Fatal(err)
+	}
+	errs := c.GetLogParseErrors()
+	if len(errs) != 2 || errs[0].PartName != "rules[0]" || !errors.Is(errs[0], ErrUnknownLevel) || errs[1].PartName != "rules[1]" {
+		t.Fatalf("GetLogParseErrors() = %v, want errors of rules[0] and rules[1]", errs)
+	}
+	// 合法的 rule 仍然生效
+	ctx := c.ContextWithHeaders(context.Background(), map[string][]string{"X-Trace": {"1"}})
+	if got := c.EnableLogPrintContext(ctx, "part1", LogTraceLevel); got != LogEnable {
+		t.Error("the valid rule is not applied")
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	c := newTestController()
+	data := "---\nrules:\n  - {match: {header: X-Debug-Tenant=acme}, parts: [part1], level: debug}\n"
+	if err := c.parse(c.sources[0], newTestConfigMap("1", data)); err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	handler := HTTPMiddleware(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, c.EnableLogPrintContext(r.Context(), "part1", LogDebugLevel))
+	}))
+	for _, tenant := range []string{"acme", "other"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Debug-Tenant", tenant)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(got) != 2 || got[0] != LogEnable || got[1] != LogDisable {
+		t.Errorf("EnableLogPrintContext in the handler = %v, want [enable disable]", got)
+	}
+}
@@ -4,120 +4,202 @@ import (
 	"context"
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
-	clientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	v1 "k8s.io/client-go/listers/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
-	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// LogLevelMap 是内置的日志级别，LogController 实际使用的日志级别见 LevelRegistry
 var LogLevelMap = map[string]int{
+	"TRACE": 0,
 	"DEBUG": 1,
 	"INFO":  2,
 	"WARN":  3,
 	"ERROR": 4,
 	"FATAL": 5,
+	"OFF":   6,
 }
 
 const (
 	LogEnable        = 0
 	LogDisable       = 10
+	LogTraceLevel    = 0
 	LogDebugLevel    = 1
 	LogInfoLevel     = 2
 	LogWarnLevel     = 3
 	LogErrorLevel    = 4
 	LogFatalLevel    = 5
+	LogOffLevel      = 6 // 配置为 OFF 的 part 不打印任何日志
 	DefaultInfoLevel = "Info"
+	PartKey          = "part" // 结构化日志（slog、logrus、zerolog）中指定 part 的属性名
 )
 
 type LogInterface interface {
 	EnableLogPrint(string, int) int
 	KlogEnableLogPrint(string, int) klog.Level
+	KlogV(string, int) klog.Verbose
+	KlogVerbose(string, klog.Level) klog.Verbose
+	VerbosityEnabled(string, int) bool
+	Part(string) *PartLogger
+	Override(string, string, time.Duration) error
+	EnableLogPrintContext(context.Context, string, int) int
+	ContextWithHeaders(context.Context, map[string][]string) context.Context
 	GetLogPartLevelMap() map[string]string
+	GetLogPartEffectiveLevels() map[string]EffectiveLevel
+	GetLogPartLevel(string) int
 	GetLogPartNameList() []string
+	GetLogPartLevelDiff() LogLevelDiff
+	GetLogParseErrors() []*LogParseError
+	OnLevelChange(func(LevelChangeEvent)) func()
+	WatchLevelChange(context.Context) <-chan LevelChangeEvent
+	Start(context.Context) error
+	WaitForSync(context.Context) error
+	Stop()
 }
 
 type LogController struct {
-	client    clientv1.ConfigMapInterface // Used for clientset mode.
-	cmLister  v1.ConfigMapLister
-	cmInfomer cache.SharedIndexInformer // Used for informer mode.
-	ctx       context.Context           // Context.
-	cmInfo    *ConfigMapInfo
-	cmChan    chan *corev1.ConfigMap // Used for informer mode to buffer ConfigMap.
+	sources       []*configMapSource // 日志配置所在的 configmap，按优先级从低到高排列，见 WithLayers
+	ctx           context.Context    // Context, canceled by Stop.
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup // 后台 goroutine，Stop 时等待其退出
+	mu            sync.Mutex     // 保护 started，并保证 Stop 之后不再启动新的 goroutine
+	started       bool
+	synced        chan struct{} // 首次加载 configmap 完成后关闭
+	cmInfo        *ConfigMapInfo
+	queue         workqueue.RateLimitingInterface // Used for informer mode to coalesce ConfigMap events.
+	unsetPart     sync.Map                        // 已提示过未配置日志级别的 partName，避免重复打印
+	handlers      levelChangeHandlers             // 日志级别变化的订阅者
+	opts          options
+	klogVerbosity klogVerbosity            // Used by KlogVerbose.
+	applyMu       sync.Mutex               // 串行化快照的发布：configmap 事件、Override 和过期定时器，保护下面三个字段及各层的 base
+	changed       *configMapSource         // 最近一次发生变化的一层 configmap，合并结果的 revision 来自这一层
+	overrides     map[string]levelOverride // Override 设置的日志级别
+	expiryTimer   *time.Timer              // 最近的过期时间到达时重新发布快照
 }
 
 type ConfigMapInfo struct {
-	name          string // ConfigMap name.
-	namespace     string // ConfigMap namespace.
-	logKey        string
 	defalultLevel string
-	partLevelMap  map[string]string
-	partList      []string
-	rev           string // ConfigMap recent revision.
-	cm            *corev1.ConfigMap
+	defaultNum    int // defalultLevel 对应的数值
+	registry      *LevelRegistry
+	pod           PodInfo      // 当前 pod 的信息，用于判断配置项的 when 条件
+	levels        atomic.Value // *revisionedLevels, 最近一次解析的结果，整体替换，不原地修改
+	parseErrs     atomic.Value // []*LogParseError, 各层 configmap 最近一次解析时的错误
 }
 
 // nowLevel 为用户此处设置日志级别
 // dynamicLevel 是 configmap 中 partName 对应的字段
-// 此处根据 dynamicLevel 和 nowLevel 判断是否打印， nowLevel >=  dynamicLevel 时，此处日志才会打印
+// 此处根据 dynamicLevel 和 nowLevel 判断是否打印， nowLevel >=  dynamicLevel 时，此处日志才会打印；dynamicLevel 为 OFF 时不打印
 // 如 nowLevel = warn， dynamic = debug， 此处日志会打印
 func (c *LogController) EnableLogPrint(partName string, nowLevel int) int {
-	var dynamicLevel string
-	var ok bool
-
-	// 使用 configmap 中为设置的 partName， 就设置为 Info 日志级别
-	if dynamicLevel, ok = c.cmInfo.partLevelMap[partName]; !ok {
-		dynamicLevel = c.cmInfo.defalultLevel
-	}
-
-	if nowLevel >= LogLevelMap[strings.ToUpper(dynamicLevel)] {
+	// 使用 configmap 中为设置的 partName， 就设置为默认日志级别
+	levels := c.cmInfo.load()
+	if c.enabled(levels, partName, levels.resolve(partName), nowLevel) {
 		return LogEnable
 	}
 	return LogDisable
 }
 
+// KlogEnableLogPrint 返回 klog.V 的参数，打印时返回 0，不打印时返回 KlogDisable，
+// 因此 klog.V(logprint.KlogEnableLogPrint(...)) 是否打印只取决于动态日志级别，不受 -v 的影响
 func (c *LogController) KlogEnableLogPrint(partName string, nowLevel int) klog.Level {
-	var dynamicLevel string
-	var ok bool
-
-	// 使用 configmap 中为设置的 partName， 就设置为 Info 日志级别
-	if dynamicLevel, ok = c.cmInfo.partLevelMap[partName]; !ok {
-		fmt.Printf("Dynamic-log-set: Not found “%s” log level set！Set the default “info” log level.\n", partName)
-		c.cmInfo.partLevelMap[partName] = c.cmInfo.defalultLevel
-		dynamicLevel = c.cmInfo.defalultLevel
+	levels, r := c.partLevel(partName)
+	if c.enabled(levels, partName, r, nowLevel) {
+		return LogEnable
 	}
+	return KlogDisable
+}
 
-	if nowLevel >= LogLevelMap[strings.ToUpper(dynamicLevel)] {
-		return LogEnable
+// partLevel 返回当前快照和 partName 生效的日志级别，configmap 中没有为其配置时提示一次并使用默认日志级别
+func (c *LogController) partLevel(partName string) (*revisionedLevels, resolvedLevel) {
+	// 使用 configmap 中为设置的 partName， 就设置为默认日志级别
+	levels := c.cmInfo.load()
+	r := levels.resolve(partName)
+	if r.rule == "" {
+		if _, loaded := c.unsetPart.LoadOrStore(partName, struct{}{}); !loaded {
+			c.opts.logger.Info("Not found log level set, use the default log level", "part", partName, "level", levels.defaultLevel)
+		}
 	}
-	return LogDisable
+	return levels, r
 }
 
+// enabled 判断日志级别为 r 的 partName 是否打印 nowLevel 级别的日志，包括 r 命中的配置项的限速和采样
+func (c *LogController) enabled(levels *revisionedLevels, partName string, r resolvedLevel, nowLevel int) bool {
+	return c.cmInfo.registry.Enabled(r.level, nowLevel) && levels.allow(r.rule, partName)
+}
+
+// GetLogPartLevelMap 返回当前 part 与日志级别映射的副本，修改返回值不会影响 LogController。
+// 包括 configmap 中的所有配置项（含 selector），以及配置最近一次变化以来代码中使用过的 part（最多 10000 个）实际生效的日志级别，
+// 日志级别来自哪一层 configmap 见 GetLogPartEffectiveLevels
 func (c *LogController) GetLogPartLevelMap() map[string]string {
-	return c.cmInfo.partLevelMap
+	levels := c.cmInfo.load()
+	m := make(map[string]string, len(levels.partLevelMap)+levels.resolved.len())
+	levels.resolved.each(func(part string, r resolvedLevel) {
+		m[part] = r.name
+	})
+	for part, level := range levels.partLevelMap {
+		m[part] = level
+	}
+	return m
+}
+
+// EffectiveLevel 是某个 part 实际生效的日志级别
+type EffectiveLevel struct {
+	Level    string    // 生效的日志级别
+	Rule     string    // 命中的配置项（精确名称、上级、glob 或 re: 正则），为空表示使用默认级别
+	Until    time.Time // 命中的配置项的过期时间，零值表示不过期
+	Override bool      // 命中的配置项是否由 Override 设置
+	Layer    string    // 日志级别所在的 configmap（namespace/name），为空表示构造函数传入的默认级别或由 Override 设置
+}
+
+// GetLogPartEffectiveLevels 返回 configmap 中精确配置的 part 和配置最近一次变化以来代码中使用过的 part 实际生效的日志级别及命中的配置项
+func (c *LogController) GetLogPartEffectiveLevels() map[string]EffectiveLevel {
+	levels := c.cmInfo.load()
+	m := make(map[string]EffectiveLevel, len(levels.partLevelMap)+levels.resolved.len())
+	levels.resolved.each(func(part string, r resolvedLevel) {
+		m[part] = levels.effectiveLevel(r.name, r.rule)
+	})
+	for part, level := range levels.partLevelMap {
+		if !isSelector(part) {
+			m[part] = levels.effectiveLevel(level, part)
+		}
+	}
+	return m
 }
 
+// GetLogPartLevel 返回 partName 实际生效的日志级别对应的数值
+func (c *LogController) GetLogPartLevel(partName string) int {
+	level, _ := c.cmInfo.load().level(partName)
+	return level
+}
+
+// GetLogPartNameList 返回当前 part 名称列表的副本
 func (c *LogController) GetLogPartNameList() []string {
-	return c.cmInfo.partList
+	return append([]string(nil), c.cmInfo.load().partList...)
+}
+
+// GetLogPartLevelDiff 返回最近一次 configmap 变化中新增、修改、删除的 part
+func (c *LogController) GetLogPartLevelDiff() LogLevelDiff {
+	return c.cmInfo.load().diff
+}
+
+// GetLogParseErrors 返回各层 configmap 最近一次解析时的错误，没有错误时返回 nil
+func (c *LogController) GetLogParseErrors() []*LogParseError {
+	errs, _ := c.cmInfo.parseErrs.Load().([]*LogParseError)
+	return append([]*LogParseError(nil), errs...)
 }
 
 // update handle ConfigMap add event.
 func (c *LogController) add(obj interface{}) {
-	if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Name == c.cmInfo.name && cm.Namespace == c.cmInfo.namespace {
-		c.cmChan <- cm
-	}
+	c.enqueue(obj)
 }
 
 // update handle ConfigMap delete event.
 func (c *LogController) delete(obj interface{}) {
-	if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Name == c.cmInfo.name && cm.Namespace == c.cmInfo.namespace {
-		c.cmInfo.rev = ""
-		// 当检测到 configmap 删除时，自动将所有字段设置为 默认级别
-		for key, _ := range c.cmInfo.partLevelMap {
-			c.cmInfo.partLevelMap[key] = c.cmInfo.defalultLevel
-		}
-		c.cmInfo.cm = &corev1.ConfigMap{}
-	}
+	c.enqueue(obj)
 }
 
 // update handle ConfigMap update event.
@@ -128,65 +210,202 @@ func (c *LogController) update(oldObj, newObj interface{}) {
 			// 在这里，你可以比较两个 ConfigMap 对象的特定字段来判断是否更新
 			if oldConfigMap.ResourceVersion != newConfigMap.ResourceVersion {
 				// 资源已更新，可以执行相应的处理逻辑
-				ns := newConfigMap.Namespace
-				name := newConfigMap.Name
-				if ns == c.cmInfo.namespace && name == c.cmInfo.name {
-					c.cmChan <- newConfigMap
-				}
+				c.enqueue(newConfigMap)
 			}
 		}
 	}
 }
 
+// enqueue 只将 configmap 的 key 放入队列，不会阻塞共享 informer 的事件分发；
+// 队列中尚未处理的相同 key 会被合并，处理时总是从 lister 读取最新的 configmap。
+// Stop 之后队列已关闭，Add 会被直接忽略（client-go 不支持移除 event handler）
+func (c *LogController) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err == nil && c.source(key) != nil {
+		c.queue.Add(key)
+	}
+}
+
 // runWithInformer handle ConfigMap changes send by informer.
 func (c *LogController) runWithInformer() {
-	for {
-		select {
-		case cm := <-c.cmChan:
-			c.parse(cm)
-		case <-c.ctx.Done():
-			return
-		}
+	for c.processNextItem() {
 	}
 }
 
-func (c *LogController) runInit(stopCh <-chan struct{}) {
-	// 获取已存在的 ConfigMap 资源列表
-	go c.cmInfomer.Run(stopCh)
-	fmt.Println("Dynamic-log-set: Initing(load exist configmap) ...")
-	if !cache.WaitForCacheSync(stopCh, c.cmInfomer.HasSynced) {
-		fmt.Println("Dynamic-log-set: Timed out waiting for caches to sync")
-		return
+// processNextItem 处理队列中的一个 key，解析失败时按退避策略重新入队，队列关闭时返回 false
+func (c *LogController) processNextItem() bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
 	}
-	// 检查 HasSynced 的值
-	if !c.cmInfomer.HasSynced() {
-		fmt.Println("Dynamic-log-set: Informer has not synced yet")
-		return
+	defer c.queue.Done(key)
+
+	if err := c.sync(key.(string)); err != nil {
+		c.opts.logger.Error(err, "Sync configmap failed, retrying", "configmap", key)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// sync 从 lister 读取 key 对应的最新的 configmap 并解析，configmap 不存在时该层的所有 part 都被视为删除
+func (c *LogController) sync(key string) error {
+	s := c.source(key)
+	cm, err := s.lister.ConfigMaps(s.namespace).Get(s.name)
+	if apierrors.IsNotFound(err) {
+		if s.base.rev != "" || len(s.base.partList) != 0 {
+			c.reset(s, "")
+		}
+		return nil
+	} else if err != nil {
+		return err
 	}
-	existingConfig, err := c.cmLister.ConfigMaps(c.cmInfo.namespace).Get(c.cmInfo.name)
+
+	// 已经解析过该 revision（如首次加载后收到的 add 事件）
+	if cm.ResourceVersion == s.base.rev {
+		return nil
+	}
+	return c.parse(s, cm)
+}
+
+// parse 解析 s 的 ConfigMap，与其他层合并生成新的快照并整体替换，同一层只在一个事件处理 goroutine 中调用。
+// 解析失败时保留该层上一次的配置并返回错误
+func (c *LogController) parse(s *configMapSource, cm *corev1.ConfigMap) error {
+	rl, err := c.cmInfo.parseConfigLogData(cm, s.logKey, s.base)
 	if err != nil {
-		fmt.Printf("Dynamic-log-set: Not found %s/%s confingmap in this cluster\n", c.cmInfo.namespace, c.cmInfo.name)
-		return
+		c.setParseError(s, c.layerError(s, &LogParseError{Revision: cm.ResourceVersion, Err: err}))
+		return err
+	}
+	for _, e := range rl.errs {
+		c.layerError(s, e)
+		c.opts.logger.Error(e, "Keep the last valid log level")
 	}
-	c.parse(existingConfig)
+	c.setBase(s, rl)
+	return nil
+}
+
+// layerError 在有多层 configmap 时为 e 记录出错的 configmap
+func (c *LogController) layerError(s *configMapSource, e *LogParseError) *LogParseError {
+	if len(c.sources) > 1 {
+		e.ConfigMap = s.key()
+	}
+	return e
+}
+
+// reset 在 s 的 configmap 被删除时调用，该层所有字段都被视为删除，恢复为其他层的配置或默认级别
+func (c *LogController) reset(s *configMapSource, rev string) {
+	rl := c.cmInfo.newRevisionedLevels()
+	rl.rev = rev
+	c.setBase(s, rl)
+}
+
+// publish 计算新快照相对当前快照的变化，替换当前快照后记录待通知的事件，调用方需持有 applyMu，并在释放后调用 notify
+func (c *LogController) publish(rl *revisionedLevels) {
+	prev := c.cmInfo.load()
+	rl.diffFrom(prev)
+	c.cmInfo.levels.Store(rl)
+	c.enqueueEvents(prev, rl)
+}
+
+// load 返回最近一次解析的快照，返回值只读
+func (cmi *ConfigMapInfo) load() *revisionedLevels {
+	return cmi.levels.Load().(*revisionedLevels)
 }
 
-func (c *LogController) parse(cm *corev1.ConfigMap) {
-	c.cmInfo.rev = cm.ResourceVersion
-	c.cmInfo.cm = cm
-	c.cmInfo.parseConfigLogData()
+// newRevisionedLevels 创建使用构造函数传入的默认级别的空快照
+func (cmi *ConfigMapInfo) newRevisionedLevels() *revisionedLevels {
+	return newRevisionedLevels(cmi.defalultLevel, cmi.defaultNum)
 }
 
-func (cmi *ConfigMapInfo) parseConfigLogData() {
-	// 获取该 configmap 中指定 key 的内容
-	lines := strings.Split(cmi.cm.Data[cmi.logKey], "\n")
-	for _, line := range lines {
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			cmi.partLevelMap[key] = value
-			cmi.partList = append(cmi.partList, key)
+// parseConfigLogData 解析 configmap 中的配置，生成新的快照。
+// 每个 revision 完整替换上一个 revision：configmap 中删除的 part 会恢复为默认级别。
+// 支持 "part: level" 文本格式和结构化的 YAML/JSON 格式，见 LogConfig。
+// 日志级别不合法的 part（或 default）保留上一个 revision 中的值，上一个 revision 中也没有时使用默认级别，
+// 错误记录在快照的 errs 中；整个配置无法解析时返回错误
+func (cmi *ConfigMapInfo) parseConfigLogData(cm *corev1.ConfigMap, logKey string, prev *revisionedLevels) (*revisionedLevels, error) {
+	config, err := ParseLogConfig(cm.Data[logKey])
+	if err != nil {
+		return nil, fmt.Errorf("parse key %q of configmap %s/%s: %w", logKey, cm.Namespace, cm.Name, err)
+	}
+
+	modified := modifiedTime(cm)
+	rl := cmi.newRevisionedLevels()
+	rl.rev = cm.ResourceVersion
+	if config.Default != "" {
+		if levelNum, ok := cmi.registry.Parse(config.Default); ok {
+			rl.defaultLevel, rl.defaultNum = config.Default, levelNum
+			rl.defaultLayer = cm.Namespace + "/" + cm.Name
+		} else {
+			rl.defaultLevel, rl.defaultNum, rl.defaultLayer = prev.defaultLevel, prev.defaultNum, prev.defaultLayer
+			rl.errs = append(rl.errs, newUnknownLevelError(rl.rev, "", config.Default))
+		}
+	}
+	for _, part := range config.partNames() {
+		pc, matched, err := config.Parts[part].forPod(cmi.pod)
+		if err == nil && !matched {
+			// 只在其他 pod 中生效的配置项
+			continue
+		}
+		if isSelector(part) {
+			if err := rl.selectors.compile(part); err != nil {
+				rl.errs = append(rl.errs, &LogParseError{Revision: rl.rev, PartName: part, Err: err})
+				continue
+			}
+		}
+		levelNum, ok := cmi.registry.Parse(pc.Level)
+		var until time.Time
+		if err == nil {
+			until, err = pc.expiry(modified, prev, part)
+		}
+		var spec limitSpec
+		if err == nil {
+			spec, err = pc.limitSpec()
+		}
+		var recSpec recorderSpec
+		if err == nil {
+			recSpec, err = cmi.recorderSpec(pc)
+		}
+		if ok && err == nil {
+			rl.set(part, pc.Level, levelNum)
+			if !until.IsZero() {
+				rl.expires[part] = until
+			}
+			if pc.For != "" {
+				rl.durations[part] = pc.value()
+			}
+			if spec.enabled() {
+				rl.limits[part] = prev.ruleLimiter(part, spec)
+			}
+			if recSpec.enabled() {
+				rl.recorders[part] = prev.recorder(part, recSpec)
+			}
+			continue
+		}
+		if !ok {
+			rl.errs = append(rl.errs, newUnknownLevelError(rl.rev, part, pc.Level))
+		} else {
+			rl.errs = append(rl.errs, &LogParseError{Revision: rl.rev, PartName: part, Err: err})
+		}
+		if prevLevel, ok := prev.partLevelMap[part]; ok {
+			rl.set(part, prevLevel, prev.partLevels[part])
+			if until, ok := prev.expires[part]; ok {
+				rl.expires[part] = until
+			}
+			if value, ok := prev.durations[part]; ok {
+				rl.durations[part] = value
+			}
+			rl.copyPartState(prev, part)
+		}
+	}
+	for i, rule := range config.Rules {
+		r, err := cmi.newContextRule(rule)
+		if err != nil {
+			rl.errs = append(rl.errs, &LogParseError{Revision: rl.rev, PartName: fmt.Sprintf("rules[%d]", i), Err: err})
+			continue
 		}
+		rl.rules = append(rl.rules, r)
 	}
+	rl.selectors.build(rl.partList)
+	return rl, nil
 }
@@ -3,34 +3,63 @@ package dynamiclog
 import (
 	"context"
 	"fmt"
-	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-	"os"
-	"strings"
+	"k8s.io/client-go/util/workqueue"
 	"time"
 )
 
 // NewWithConfigPath  create konfig with shared informer factory.
-func NewWithConfigPath(ctx context.Context, configPath string, name, namespace, logKey, defaultLevel string) LogInterface {
+// kubeconfig 不合法时返回 ErrInvalidKubeconfig，缺少 RBAC 权限时返回 ErrForbidden，其他错误见 NewWithSharedInformerFactory
+func NewWithConfigPath(ctx context.Context, configPath string, name, namespace, logKey, defaultLevel string, opts ...Option) (LogInterface, error) {
 	config, err := clientcmd.BuildConfigFromFlags("", configPath)
 	if err != nil {
-		fmt.Printf("Error building kubeconfig: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKubeconfig, err)
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		fmt.Printf("Error creating Kubernetes client: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKubeconfig, err)
 	}
 
-	// 创建 SharedInformerFactory
-	sharedInformerFactory := informers.NewSharedInformerFactory(clientset, time.Second*30)
-	c := NewWithSharedInformerFactory(ctx, sharedInformerFactory, namespace, name, logKey, defaultLevel)
-	return c
+	// 检查是否具有读取 configmap 所需的 RBAC 权限
+	if err := CheckAccess(ctx, clientset, namespace, name); err != nil {
+		return nil, err
+	}
+	// 其他层的 configmap 可能在其他 namespace，没有指定 factory 时各自创建只监听该 configmap 的 factory
+	layers := newOptions(opts).layers
+	for i, layer := range layers {
+		if err := CheckAccess(ctx, clientset, layer.Namespace, layer.Name); err != nil {
+			return nil, err
+		}
+		if layer.Factory == nil {
+			layers[i].Factory = NewConfigMapInformerFactory(clientset, layer.Namespace, layer.Name)
+			layers[i].owned = true
+		}
+	}
+	if len(layers) != 0 {
+		opts = append(opts, WithLayers(layers...))
+	}
+
+	// 创建只监听 namespace/name 这一个 configmap 的 SharedInformerFactory，其中的 informer 由 LogController 运行，Stop 时停止
+	sharedInformerFactory := NewConfigMapInformerFactory(clientset, namespace, name)
+	return newWithInformerFactory(ctx, sharedInformerFactory, true, namespace, name, logKey, defaultLevel, opts...)
+}
+
+// NewConfigMapInformerFactory 创建只 list/watch namespace 下名称为 name 的 configmap 的 SharedInformerFactory，
+// 只需要 namespace 级别的 RBAC 权限（见 ConfigMapVerbs），内存中也只缓存这一个 configmap。
+// 注意：field selector 会作用于该 factory 创建的所有 informer，因此该 factory 只应交给 NewWithSharedInformerFactory 使用
+func NewConfigMapInformerFactory(clientset kubernetes.Interface, namespace, name string) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(clientset, time.Second*30,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
 }
 
 // NewWithSharedInformerFactory create konfig with shared informer factory.
@@ -40,34 +69,87 @@ func NewWithConfigPath(ctx context.Context, configPath string, name, namespace,
 // cmName --> log-configmap 的名称，
 // cmLogKey --> log-configmap 中 log 配置字段的 key 值（可以理解是文件名，就是下面命令中的 log； kubectl -n default create configmap log-demo-set --from-file=log），
 // logDefaultLevel --> 若没有配置字段，或误删除，会配置此 log 级别
-func NewWithSharedInformerFactory(ctx context.Context, factory informers.SharedInformerFactory, cmNamespace, cmName, cmLogKey, logDefaultLevel string) LogInterface {
-	c := &LogController{
-		ctx:       ctx,
-		cmLister:  factory.Core().V1().ConfigMaps().Lister(),
-		cmInfomer: factory.Core().V1().ConfigMaps().Informer(),
-		cmChan:    make(chan *corev1.ConfigMap, 10),
-		cmInfo: &ConfigMapInfo{
-			name:          cmName,
-			namespace:     cmNamespace,
-			logKey:        cmLogKey,
-			cm:            &corev1.ConfigMap{},
-			defalultLevel: logDefaultLevel,
-			partLevelMap:  make(map[string]string),
-		},
-	}
+// factory 由调用方所有，需要先调用 factory.Core().V1().ConfigMaps().Informer() 再调用 factory.Start，
+// LogController 不会运行或停止其中的 informer，factory 没有启动时等待缓存同步超时。
+// 缓存同步超时返回 ErrCacheSyncTimeout，configmap 不存在时返回 ErrConfigMapNotFound（可通过 WithDefaultsIfMissing 以默认级别启动）。
+// WithLayers 中没有指定 Factory 的 configmap 也使用 factory，此时 factory 需要能看到这些 configmap
+func NewWithSharedInformerFactory(ctx context.Context, factory informers.SharedInformerFactory, cmNamespace, cmName, cmLogKey, logDefaultLevel string, opts ...Option) (LogInterface, error) {
+	return newWithInformerFactory(ctx, factory, false, cmNamespace, cmName, cmLogKey, logDefaultLevel, opts...)
+}
 
-	if _, ok := LogLevelMap[strings.ToUpper(logDefaultLevel)]; !ok {
-		c.cmInfo.defalultLevel = DefaultInfoLevel
+// newWithInformerFactory 创建 informer 模式的 LogController，owned 表示 factory 由 LogController 创建，
+// 其中的 informer 由 LogController 运行并在 Stop 时停止
+func newWithInformerFactory(ctx context.Context, factory informers.SharedInformerFactory, owned bool, cmNamespace, cmName, cmLogKey, logDefaultLevel string, opts ...Option) (LogInterface, error) {
+	c := newLogController(ctx, cmNamespace, cmName, cmLogKey, logDefaultLevel, opts)
+	for _, s := range c.sources {
+		if s.factory == nil {
+			s.factory, s.owned = factory, owned
+		}
+		s.lister = s.factory.Core().V1().ConfigMaps().Lister()
+		s.informer = s.factory.Core().V1().ConfigMaps().Informer()
 	}
+	c.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "dynamic-log-set")
 
 	// Add ConfigMap event handler.
-	c.cmInfomer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    c.add,
-		UpdateFunc: c.update,
-		DeleteFunc: c.delete,
-	})
-	stopCh := make(chan struct{})
-	c.runInit(stopCh)
-	go c.runWithInformer()
+	informers, _ := c.informers()
+	for _, informer := range informers {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.add,
+			UpdateFunc: c.update,
+			DeleteFunc: c.delete,
+		})
+	}
+	if err := c.Start(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewWithClientset create log controller with kubernetes clientset.
+// 不依赖 informer，只 list+watch 名称为 cmName 的 configmap（metadata.name field selector），
+// watch 断开后从最近的 resourceVersion 继续，resourceVersion 过期（410 Gone）时重新 list，出错时退避重试。
+// 参数含义与 NewWithSharedInformerFactory 相同，首次 list 失败时返回错误（无权限时为 ErrForbidden），
+// configmap 不存在时返回 ErrConfigMapNotFound（可通过 WithDefaultsIfMissing 以默认级别启动）。
+// WithLayers 中的每个 configmap 都单独 list+watch
+func NewWithClientset(ctx context.Context, clientset kubernetes.Interface, cmNamespace, cmName, cmLogKey, logDefaultLevel string, opts ...Option) (LogInterface, error) {
+	c := newLogController(ctx, cmNamespace, cmName, cmLogKey, logDefaultLevel, opts)
+	for _, s := range c.sources {
+		s.client = clientset.CoreV1().ConfigMaps(s.namespace)
+	}
+
+	if err := c.Start(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newLogController 创建尚未启动的 LogController，ctx 结束或调用 Stop 后 LogController 停止
+func newLogController(ctx context.Context, cmNamespace, cmName, cmLogKey, logDefaultLevel string, opts []Option) *LogController {
+	o := newOptions(opts)
+	c := &LogController{
+		opts:   o,
+		cmInfo: newConfigMapInfo(logDefaultLevel, o.registry, o.podInfo()),
+		synced: make(chan struct{}),
+	}
+	c.klogVerbosity = newKlogVerbosity(o.klogVerbosity, o.registry, o.logger)
+	c.sources = c.newSources(cmNamespace, cmName, cmLogKey)
+	c.overrides = make(map[string]levelOverride)
+	c.ctx, c.cancel = context.WithCancel(ctx)
 	return c
 }
+
+// newConfigMapInfo 创建 ConfigMapInfo，logDefaultLevel 不合法时使用 DefaultInfoLevel
+func newConfigMapInfo(logDefaultLevel string, registry *LevelRegistry, pod PodInfo) *ConfigMapInfo {
+	cmi := &ConfigMapInfo{
+		defalultLevel: logDefaultLevel,
+		registry:      registry,
+		pod:           pod,
+	}
+
+	if _, ok := registry.Parse(logDefaultLevel); !ok {
+		cmi.defalultLevel = DefaultInfoLevel
+	}
+	cmi.defaultNum, _ = registry.Parse(cmi.defalultLevel)
+	cmi.levels.Store(cmi.newRevisionedLevels())
+	return cmi
+}
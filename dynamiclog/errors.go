@@ -0,0 +1,70 @@
+package dynamiclog
+
+import (
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// 构造函数返回的错误都包装了下面的某个错误，可以通过 errors.Is 判断
+var (
+	ErrInvalidKubeconfig = errors.New("dynamic-log-set: invalid kubeconfig")
+	ErrCacheSyncTimeout  = errors.New("dynamic-log-set: timed out waiting for configmap cache to sync")
+	ErrConfigMapNotFound = errors.New("dynamic-log-set: configmap not found")
+	ErrForbidden         = errors.New("dynamic-log-set: forbidden to read configmap")
+	ErrStopped           = errors.New("dynamic-log-set: log controller stopped")
+)
+
+// 解析 configmap 时的错误，LogParseError 包装了下面的某个错误
+var (
+	ErrUnknownLevel    = errors.New("unknown log level")       // configmap 中配置了不存在的日志级别
+	ErrInvalidTTL      = errors.New("invalid level expiry")    // until= 或 for= 不合法
+	ErrInvalidLimit    = errors.New("invalid rate limit")      // rate=、burst=、first=、thereafter= 不合法
+	ErrInvalidRecorder = errors.New("invalid flight recorder") // record=、trigger= 不合法
+	ErrInvalidTarget   = errors.New("invalid pod target")      // when 中的条件不合法
+)
+
+// LogParseError 描述解析 configmap 某个 revision 时的错误
+type LogParseError struct {
+	ConfigMap string // 出错的 configmap（namespace/name），只在有多层 configmap 时设置
+	Revision  string // ConfigMap resourceVersion.
+	PartName  string // 出错的 part，为空表示 default 字段或整个配置
+	Value     string // 出错的日志级别
+	Err       error
+}
+
+func newUnknownLevelError(rev, partName, value string) *LogParseError {
+	return &LogParseError{Revision: rev, PartName: partName, Value: value, Err: ErrUnknownLevel}
+}
+
+func (e *LogParseError) Error() string {
+	prefix := "revision " + e.Revision
+	if e.ConfigMap != "" {
+		prefix = "configmap " + e.ConfigMap + " " + prefix
+	}
+	if e.PartName != "" {
+		prefix += fmt.Sprintf(": part %q", e.PartName)
+	} else if e.Value != "" {
+		prefix += ": default"
+	}
+	if e.Value != "" {
+		return fmt.Sprintf("%s: %v %q", prefix, e.Err, e.Value)
+	}
+	return fmt.Sprintf("%s: %v", prefix, e.Err)
+}
+
+func (e *LogParseError) Unwrap() error {
+	return e.Err
+}
+
+// wrapAPIError 将访问 configmap 时的 apiserver 错误转换为对应的 sentinel 错误
+func wrapAPIError(err error, namespace, name string) error {
+	switch {
+	case apierrors.IsNotFound(err):
+		return fmt.Errorf("%w: %s/%s", ErrConfigMapNotFound, namespace, name)
+	case apierrors.IsForbidden(err):
+		return fmt.Errorf("%w: %s/%s: %v", ErrForbidden, namespace, name, err)
+	}
+	return err
+}
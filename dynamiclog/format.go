@@ -0,0 +1,371 @@
+package dynamiclog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LogConfig 是 configmap 中 logKey 对应内容的结构化格式，支持 YAML 和 JSON：
+//
+//	---
+//	default: info
+//	parts:
+//	  part1: debug
+//	  part2:
+//	    level: warn
+//	  part3:
+//	    level: debug
+//	    for: 30m        # 或 until: "2026-10-18T12:00:00Z"，见 Override 上方的说明
+//	  part4:            # 按 pod 生效的多个配置，以最后一个匹配当前 pod 的为准，见 PodInfo
+//	  - info
+//	  - {level: debug, when: {pod: api-7c9f-xyz}}
+//
+// 以下情况按结构化格式解析，否则按 "part: level" 文本格式解析：
+//  1. 以 "---" 行开头（与 konfig 相同）
+//  2. 以 "{" 开头的 JSON
+//  3. 顶层包含 parts 字段且其值为 map，或包含 rules 字段且其值为列表
+type LogConfig struct {
+	Default string                `json:"default,omitempty"` // 未配置的 part 使用的日志级别，为空时使用构造函数传入的默认级别
+	Parts   map[string]PartConfig `json:"parts,omitempty"`
+	Rules   []RuleConfig          `json:"rules,omitempty"` // 请求级别的日志级别，见 ContextWithHeaders
+
+	order []string // part 首次出现的顺序（结构化格式中为 parts 的 key 的顺序），决定正则 selector 的匹配顺序
+}
+
+// PartConfig 是单个 part 的配置，可以简写为 "part: level" 或 "part: level key=value ... [when key=value ...]"，
+// 如 "part: debug for=30m rate=100/s when pod=api-7c9f-xyz"
+type PartConfig struct {
+	Level string `json:"level"`
+	Until string `json:"until,omitempty"` // 过期时间，RFC3339 格式
+	For   string `json:"for,omitempty"`   // 有效时长，从该配置项最后一次修改的时间开始计算，如 30m
+
+	Rate       string `json:"rate,omitempty"`       // 限速，如 100/s，见 limitSpec
+	Burst      int    `json:"burst,omitempty"`      // 限速允许的突发日志数，默认与每个时间单位的日志数相同
+	First      int    `json:"first,omitempty"`      // 采样：每秒前 First 条都打印
+	Thereafter int    `json:"thereafter,omitempty"` // 采样：之后每 Thereafter 条打印 1 条
+
+	Record  string `json:"record,omitempty"`  // flight recorder 保留的记录，条数（如 100）或时长（如 30s），见 recorderSpec
+	Trigger string `json:"trigger,omitempty"` // 打印该级别及以上的日志时输出 flight recorder 中的记录，默认为 error
+
+	When *TargetConfig `json:"when,omitempty"` // 只在匹配的 pod 中生效，见 PodInfo
+
+	fallback *PartConfig // 文本格式中同一 part 之前的配置或结构化格式列表中之前的配置，When 不匹配时使用
+}
+
+// UnmarshalJSON 支持 "part: level" 简写、"part: {level: level}" 和按 pod 生效的列表 "part: [level, {level: level, when: ...}]" 三种写法，
+// 列表与文本格式中同一 part 出现多次相同，以最后一个匹配当前 pod 的为准
+func (pc *PartConfig) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return fmt.Errorf("empty list of part configs")
+		}
+		var config *PartConfig
+		for _, item := range items {
+			if bytes.HasPrefix(bytes.TrimSpace(item), []byte("[")) {
+				return fmt.Errorf("unexpected nested list of part configs")
+			}
+			next := &PartConfig{}
+			if err := json.Unmarshal(item, next); err != nil {
+				return err
+			}
+			if next.When != nil {
+				next.fallback = config
+			}
+			config = next
+		}
+		*pc = *config
+		return nil
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var value levelValue
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		config, err := parsePartValue(string(value))
+		if err != nil {
+			return err
+		}
+		*pc = config
+		return nil
+	}
+	type partConfig PartConfig
+	config := struct {
+		Level levelValue `json:"level"`
+		*partConfig
+	}{partConfig: (*partConfig)(pc)}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return err
+	}
+	pc.Level = string(config.Level)
+	return nil
+}
+
+// levelValue 是结构化格式中的日志级别，除字符串外也接受数值（part1: 3）。
+// true、false 保留原文，由 LevelRegistry 报告为该 part 的未知日志级别，不影响其他 part
+type levelValue string
+
+func (v *levelValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = levelValue(s)
+		return nil
+	}
+	var scalar interface{}
+	if err := json.Unmarshal(data, &scalar); err != nil {
+		return err
+	}
+	switch scalar.(type) {
+	case nil:
+		*v = ""
+	case float64, bool:
+		*v = levelValue(bytes.TrimSpace(data))
+	default:
+		return fmt.Errorf("expect log level, got %s", data)
+	}
+	return nil
+}
+
+// partNames 返回 part 在配置中出现的顺序，不在 order 中的 part（如直接构造的 LogConfig）按名称排在最后，保证快照中 partList 的顺序稳定
+func (lc *LogConfig) partNames() []string {
+	names := make([]string, 0, len(lc.Parts))
+	seen := make(map[string]bool, len(lc.order))
+	for _, name := range lc.order {
+		if _, ok := lc.Parts[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	rest := len(names)
+	for name := range lc.Parts {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[rest:])
+	return names
+}
+
+// ParseLogConfig 解析 logKey 对应的内容，自动识别结构化格式和 "part: level" 文本格式
+func ParseLogConfig(data string) (*LogConfig, error) {
+	trimmed := strings.TrimSpace(data)
+	switch {
+	case trimmed == "":
+		return &LogConfig{}, nil
+	case strings.HasPrefix(trimmed, "---"):
+		return parseStructured(strings.TrimPrefix(trimmed, "---"))
+	case strings.HasPrefix(trimmed, "{"):
+		return parseStructured(trimmed)
+	case hasPartsField(trimmed):
+		return parseStructured(trimmed)
+	}
+	return parseText(data)
+}
+
+// parseStructured 解析 YAML/JSON 格式，part 名称和日志级别不能为空。
+// YAML 按 1.2 解析：off、no 等是字符串而不是布尔值，因此 part1: off 与文本格式相同
+func parseStructured(data string) (*LogConfig, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := doc.Decode(&value); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(jsonValue(value))
+	if err != nil {
+		return nil, err
+	}
+	config := &LogConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, err
+	}
+	config.order = partsOrder(&doc)
+	for name, part := range config.Parts {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("empty part name")
+		}
+		for p := &part; p != nil; p = p.fallback {
+			if strings.TrimSpace(p.Level) == "" {
+				return nil, fmt.Errorf("empty level of part %q", name)
+			}
+		}
+	}
+	return config, nil
+}
+
+// partsOrder 返回 doc 顶层 parts 中 key 的顺序，JSON 也按 YAML 解析，map 解析后会丢失该顺序
+func partsOrder(doc *yaml.Node) []string {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	top := doc.Content[0].Content
+	for i := 0; i+1 < len(top); i += 2 {
+		if top[i].Value != "parts" || top[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		parts := top[i+1].Content
+		order := make([]string, 0, len(parts)/2)
+		for j := 0; j+1 < len(parts); j += 2 {
+			order = append(order, parts[j].Value)
+		}
+		return order
+	}
+	return nil
+}
+
+// jsonValue 将 YAML 解析出的值转换为可以编码为 JSON 的值，非字符串的 key（如 part 名称 3）转换为字符串
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+// hasPartsField 判断 data 是否是顶层包含 parts map 或 rules 列表的 YAML，
+// 文本格式中 "parts: level" 的 parts 值为字符串，不会被误判
+func hasPartsField(data string) bool {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal([]byte(data), &m); err != nil {
+		return false
+	}
+	if _, ok := m["parts"].(map[string]interface{}); ok {
+		return true
+	}
+	_, ok := m["rules"].([]interface{})
+	return ok
+}
+
+// splitTextLine 将 "part: level" 拆分为 part 和 level。
+// 正则 selector 本身可能包含 ":"，因此以最后一个 ": " 拆分
+func splitTextLine(line string) (string, string, bool) {
+	var key, value string
+	if strings.HasPrefix(line, regexPrefix) {
+		i := strings.LastIndex(line, ": ")
+		if i < 0 {
+			return "", "", false
+		}
+		key, value = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+	} else {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return "", "", false
+		}
+		key, value = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if strings.ContainsAny(key, " \t") {
+			return "", "", false
+		}
+	}
+	return key, value, key != "" && value != ""
+}
+
+// parseText 解析 "part: level" 文本格式，每行一个 part。
+// 空行、# 开头的注释行和行尾 # 注释会被忽略，缩进的行、part 名称或日志级别为空的行会返回错误
+func parseText(data string) (*LogConfig, error) {
+	config := &LogConfig{Parts: make(map[string]PartConfig)}
+	for i, line := range strings.Split(data, "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unexpected indentation", i+1)
+		}
+
+		key, value, ok := splitTextLine(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expect \"part: level\"", i+1)
+		}
+		if _, ok := config.Parts[key]; !ok {
+			config.order = append(config.order, key)
+		}
+		part, err := parsePartValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if prev, ok := config.Parts[key]; ok && part.When != nil {
+			part.fallback = &prev
+		}
+		config.Parts[key] = part
+	}
+	return config, nil
+}
+
+// parsePartValue 解析 "level" 或 "level key=value ... [when key=value ...]" 形式的简写
+func parsePartValue(value string) (PartConfig, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return PartConfig{}, nil
+	}
+	config := PartConfig{Level: fields[0]}
+	for i, field := range fields[1:] {
+		if field == "when" {
+			target, err := parseTarget(fields[i+2:])
+			if err != nil {
+				return PartConfig{}, err
+			}
+			config.When = target
+			break
+		}
+		kv := strings.SplitN(field, "=", 2)
+		switch {
+		case len(kv) != 2:
+			return PartConfig{}, fmt.Errorf("expect \"key=value\" after level, got %q", field)
+		case kv[0] == "until":
+			config.Until = kv[1]
+		case kv[0] == "for":
+			config.For = kv[1]
+		case kv[0] == "rate":
+			config.Rate = kv[1]
+		case kv[0] == "record":
+			config.Record = kv[1]
+		case kv[0] == "trigger":
+			config.Trigger = kv[1]
+		case kv[0] == "burst", kv[0] == "first", kv[0] == "thereafter":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return PartConfig{}, fmt.Errorf("invalid %s %q", kv[0], kv[1])
+			}
+			switch kv[0] {
+			case "burst":
+				config.Burst = n
+			case "first":
+				config.First = n
+			default:
+				config.Thereafter = n
+			}
+		default:
+			return PartConfig{}, fmt.Errorf("unknown option %q", kv[0])
+		}
+	}
+	return config, nil
+}
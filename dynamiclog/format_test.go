@@ -0,0 +1,164 @@
+package dynamiclog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestOffAndNumericLevels off 和数值级别在文本格式和结构化格式中的含义相同，
+// YAML 1.1 中会被当作布尔值的 off、no 在结构化格式中仍然是日志级别
+func TestOffAndNumericLevels(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{"text", "part1: off\npart2: 3\npart3: debug\n"},
+		{"yaml", "---\nparts:\n  part1: off\n  part2: 3\n  part3: debug\n"},
+		{"yaml object", "---\nparts:\n  part1: {level: off}\n  part2: {level: 3}\n  part3: {level: debug}\n"},
+		{"json", `{"parts": {"part1": "off", "part2": 3, "part3": {"level": "debug"}}}`},
+	} {
+		c := newTestController()
+		if err := c.parse(c.sources[0], newTestConfigMap("1", tc.data)); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if errs := c.GetLogParseErrors(); len(errs) != 0 {
+			t.Errorf("%s: GetLogParseErrors() = %v", tc.name, errs)
+		}
+		for _, want := range []struct {
+			part  string
+			level int
+		}{
+			{"part1", LogOffLevel},
+			{"part2", LogWarnLevel},
+			{"part3", LogDebugLevel},
+		} {
+			if got := c.GetLogPartLevel(want.part); got != want.level {
+				t.Errorf("%s: GetLogPartLevel(%q) = %d, want %d", tc.name, want.part, got, want.level)
+			}
+		}
+		if got := c.EnableLogPrint("part1", LogFatalLevel); got != LogDisable {
+			t.Errorf("%s: part1 is off but prints fatal logs", tc.name)
+		}
+	}
+}
+
+// TestStructuredBoolLevel 结构化格式中的布尔值只作为该 part 的未知日志级别报告，不影响其他 part
+func TestStructuredBoolLevel(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "---\nparts:\n  part1: true\n  part2: debug\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetLogPartLevel("part2"); got != LogDebugLevel {
+		t.Errorf("GetLogPartLevel(part2) = %d, want debug", got)
+	}
+	if errs := c.GetLogParseErrors(); len(errs) != 1 || errs[0].PartName != "part1" {
+		t.Errorf("GetLogParseErrors() = %v, want the error of part1", errs)
+	}
+}
+
+func TestParseLogConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		want    string // 按配置顺序的 part:level，default 为 Default
+		wantErr bool
+	}{
+		{name: "empty", data: "  \n", want: "[]"},
+		{name: "text", data: "part1: debug\npart2: warn\n", want: "[part1:debug part2:warn]"},
+		{name: "yaml with header", data: "---\ndefault: warn\nparts:\n  part2: debug\n  part1: {level: info}\n", want: "[default:warn part2:debug part1:info]"},
+		{name: "json", data: `{"default": "warn", "parts": {"part1": "debug"}}`, want: "[default:warn part1:debug]"},
+		{name: "parts map without header", data: "parts:\n  part1: debug\n", want: "[part1:debug]"},
+		{name: "rules without header", data: "rules:\n  - {match: {header: X-Debug}, level: debug}\n", want: "[]"},
+		// 文本格式中名为 parts 的 part，值为字符串，不会被当作结构化格式
+		{name: "text part named parts", data: "parts: debug\npart1: info\n", want: "[parts:debug part1:info]"},
+		{name: "text comments", data: "# comment\npart1: debug # trailing\n\n  # indented comment\npart2: warn\n", want: "[part1:debug part2:warn]"},
+		{name: "yaml comments", data: "---\n# comment\nparts:\n  part1: debug # trailing\n", want: "[part1:debug]"},
+		// 文本格式中同一 part 出现多次时以最后一次为准
+		{name: "text duplicate parts", data: "part1: debug\npart2: info\npart1: warn\n", want: "[part1:warn part2:info]"},
+		{name: "yaml duplicate parts", data: "---\nparts:\n  part1: debug\n  part1: warn\n", wantErr: true},
+		{name: "text indentation", data: "part1: debug\n  part2: warn\n", wantErr: true},
+		{name: "yaml indentation", data: "---\nparts:\n  part1: debug\n part2: warn\n", wantErr: true},
+		{name: "text missing colon", data: "part1 debug\n", wantErr: true},
+		{name: "text empty level", data: "part1:\n", wantErr: true},
+		{name: "yaml unknown field", data: "---\nlevels:\n  part1: debug\n", wantErr: true},
+		{name: "yaml empty level", data: "---\nparts:\n  part1: {level: \"\"}\n", wantErr: true},
+		{name: "json syntax", data: `{"parts": {"part1": "debug"}`, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := ParseLogConfig(tc.data)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseLogConfig() = %+v, want error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			if config.Default != "" {
+				got = append(got, "default:"+config.Default)
+			}
+			for _, part := range config.partNames() {
+				got = append(got, part+":"+config.Parts[part].Level)
+			}
+			if fmt.Sprint(got) != tc.want {
+				t.Errorf("ParseLogConfig() = %v, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestUnknownLevel 写错的日志级别只影响该 part：保留上一次的合法级别，没有时使用默认级别
+func TestUnknownLevel(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "part1: debug\npart3: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+	data := "---\ndefault: loud\nparts:\n  part1: dbug\n  part2: verbose\n  part3: error\n"
+	if err := c.parse(c.sources[0], newTestConfigMap("2", data)); err != nil {
+		t.Fatal(err)
+	}
+	for part, want := range map[string]int{"part1": LogDebugLevel, "part2": LogInfoLevel, "part3": LogErrorLevel, "other": LogInfoLevel} {
+		if got := c.GetLogPartLevel(part); got != want {
+			t.Errorf("GetLogPartLevel(%q) = %d, want %d", part, got, want)
+		}
+	}
+	errs := c.GetLogParseErrors()
+	var got []string
+	for _, e := range errs {
+		if e.Revision != "2" || !errors.Is(e, ErrUnknownLevel) {
+			t.Errorf("error %v: want ErrUnknownLevel of revision 2", e)
+		}
+		got = append(got, e.PartName+"="+e.Value)
+	}
+	if want := "[=loud part1=dbug part2=verbose]"; fmt.Sprint(got) != want {
+		t.Errorf("GetLogParseErrors() = %v, want %s", got, want)
+	}
+
+	// 修正后错误被清除
+	if err := c.parse(c.sources[0], newTestConfigMap("3", "part1: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+	if errs := c.GetLogParseErrors(); len(errs) != 0 {
+		t.Errorf("GetLogParseErrors() = %v after the levels are fixed", errs)
+	}
+}
+
+// TestUnparsableConfigKeepsLevels 整个配置无法解析时保留上一次的配置，错误中记录 revision
+func TestUnparsableConfigKeepsLevels(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "part1: debug\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.parse(c.sources[0], newTestConfigMap("2", "part1 warn\n")); err == nil {
+		t.Fatal("parse() accepts an unparsable config")
+	}
+	if got := c.GetLogPartLevel("part1"); got != LogDebugLevel {
+		t.Errorf("GetLogPartLevel(part1) = %d, want the last valid level debug", got)
+	}
+	if errs := c.GetLogParseErrors(); len(errs) != 1 || errs[0].Revision != "2" || errs[0].PartName != "" {
+		t.Errorf("GetLogParseErrors() = %v, want the error of revision 2", errs)
+	}
+}
@@ -0,0 +1,116 @@
+package dynamiclog
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// part 名称可以用 "." 或 "/" 分层，如 controller.reconcile.pods。
+// 没有精确配置的 part 会继承最长的上级配置：
+//
+//	controller: warn           # 作用于 controller 及其所有下级
+//	controller.*: debug        # 只作用于 controller 的下级，同一层级下优先于 controller
+//	controller.reconcile: info
+//
+// 上面的配置中 controller 为 warn，controller.cache 为 debug，controller.reconcile.pods 为 info。
+
+// partSeparators 是 part 名称的分层分隔符
+const partSeparators = "./"
+
+// resolvedLevel 是 part 解析得到的日志级别
+type resolvedLevel struct {
+	level int
+	name  string // 日志级别在 configmap 中的写法，使用默认级别时为默认级别
+	rule  string // 命中的配置项，为空表示使用默认级别
+}
+
+// maxResolvedParts 是每个快照最多缓存的 part 数量，超过后新的 part 每次都重新解析，避免 part 名称不断变化时缓存无限增长
+const maxResolvedParts = 10000
+
+// resolveCache 缓存 part 的解析结果，读写都不需要复制 map。
+// 每个快照有各自的缓存，configmap 变化后从空缓存开始，只缓存之后用到的 part
+type resolveCache struct {
+	m sync.Map // map[string]resolvedLevel
+	n atomic.Int32
+}
+
+func (rc *resolveCache) load(partName string) (resolvedLevel, bool) {
+	r, ok := rc.m.Load(partName)
+	if !ok {
+		return resolvedLevel{}, false
+	}
+	return r.(resolvedLevel), true
+}
+
+// each 遍历缓存的所有解析结果
+func (rc *resolveCache) each(fn func(partName string, r resolvedLevel)) {
+	rc.m.Range(func(k, v interface{}) bool {
+		fn(k.(string), v.(resolvedLevel))
+		return true
+	})
+}
+
+// len 返回缓存的 part 数量
+func (rc *resolveCache) len() int {
+	return int(rc.n.Load())
+}
+
+// store 缓存 partName 的解析结果，缓存已满时忽略
+func (rc *resolveCache) store(partName string, r resolvedLevel) {
+	if rc.n.Load() >= maxResolvedParts {
+		return
+	}
+	if _, loaded := rc.m.LoadOrStore(partName, r); !loaded {
+		rc.n.Add(1)
+	}
+}
+
+// resolve 返回 partName 的日志级别并缓存解析结果，优先级见 lookup
+func (rl *revisionedLevels) resolve(partName string) resolvedLevel {
+	if level, ok := rl.partLevels[partName]; ok {
+		return resolvedLevel{level: level, name: rl.partLevelMap[partName], rule: partName}
+	}
+	if r, ok := rl.resolved.load(partName); ok {
+		return r
+	}
+	r := rl.lookup(partName)
+	rl.resolved.store(partName, r)
+	return r
+}
+
+// lookup 返回 partName 的日志级别，不使用也不写入缓存。优先级：
+// 精确配置 > 最近的上级（"parent.*" 优先于 "parent"） > 最长的 glob > 按配置顺序第一个匹配的正则 > 默认级别
+func (rl *revisionedLevels) lookup(partName string) resolvedLevel {
+	if level, ok := rl.partLevels[partName]; ok {
+		return resolvedLevel{level: level, name: rl.partLevelMap[partName], rule: partName}
+	}
+	for parent := partName; ; {
+		i := strings.LastIndexAny(parent, partSeparators)
+		if i < 0 {
+			break
+		}
+		parent = parent[:i]
+		if rule, level, ok := rl.matchParent(parent); ok {
+			return resolvedLevel{level: level, name: rl.partLevelMap[rule], rule: rule}
+		}
+	}
+	if rule, ok := rl.selectors.match(partName); ok {
+		return resolvedLevel{level: rl.partLevels[rule], name: rl.partLevelMap[rule], rule: rule}
+	}
+	return resolvedLevel{level: rl.defaultNum, name: rl.defaultLevel}
+}
+
+// matchParent 查找上级 parent 的配置，"parent.*" 或 "parent/*" 优先于 "parent"
+func (rl *revisionedLevels) matchParent(parent string) (string, int, bool) {
+	for _, sep := range partSeparators {
+		rule := parent + string(sep) + "*"
+		if level, ok := rl.partLevels[rule]; ok {
+			return rule, level, true
+		}
+	}
+	if level, ok := rl.partLevels[parent]; ok {
+		return parent, level, true
+	}
+	return "", 0, false
+}
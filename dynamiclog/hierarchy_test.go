@@ -0,0 +1,41 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestResolveCacheBounded 大量不同的 part 名称不会使缓存无限增长，超过上限的 part 仍然能正确解析，
+// configmap 变化后新快照不会继承之前解析过的 part
+func TestResolveCacheBounded(t *testing.T) {
+	c := newTestController()
+	s := c.sources[0]
+	if err := c.parse(s, newTestConfigMap("1", "controller: warn\ncontroller.*: debug\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	const parts = 2 * maxResolvedParts
+	for i := 0; i < parts; i++ {
+		if got := c.EnableLogPrint(fmt.Sprintf("controller.worker%d", i), LogDebugLevel); got != LogEnable {
+			t.Fatalf("controller.worker%d should inherit debug from controller.*", i)
+		}
+	}
+	if n := c.cmInfo.load().resolved.len(); n != maxResolvedParts {
+		t.Errorf("cached %d parts, want %d", n, maxResolvedParts)
+	}
+
+	// 上一个快照中解析过的 part 的变化仍然出现在 diff 中
+	if err := c.parse(s, newTestConfigMap("2", "controller: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+	levels := c.cmInfo.load()
+	if n := levels.resolved.len(); n != 0 {
+		t.Errorf("new snapshot cached %d parts, want 0", n)
+	}
+	if n := len(levels.diff.Changed); n != maxResolvedParts {
+		t.Errorf("diff has %d changed parts, want %d", n, maxResolvedParts)
+	}
+	if got := c.EnableLogPrint("controller.worker0", LogDebugLevel); got != LogDisable {
+		t.Error("controller.worker0 should inherit warn from controller")
+	}
+}
@@ -0,0 +1,89 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+// KlogDisable 是 KlogEnableLogPrint 不打印时返回的 klog 级别，
+// 取 klog.Level 的最大值，即使进程以 -v=10 启动，klog.V(KlogDisable) 也不会打印
+const KlogDisable klog.Level = math.MaxInt32
+
+// DefaultKlogVerbosity 是 part 配置的日志级别与 klog V 级别的默认映射，
+// 按照 klog 的惯例：V(0) 总是打印，V(2) 为常规信息，V(4) 为调试信息，V(5) 及以上为更详细的跟踪信息。
+// V 级别的日志都是 info 日志，part 配置的级别高于 info（如 warn、error）时任何 V 级别都不打印，因此不需要映射
+var DefaultKlogVerbosity = map[string]klog.Level{
+	"TRACE": 10,
+	"DEBUG": 4,
+	"INFO":  2,
+}
+
+// klogVerbosity 是按日志级别数值从小到大排序的 V 级别映射
+type klogVerbosity []klogVerbosityLevel
+
+type klogVerbosityLevel struct {
+	level int
+	v     klog.Level
+}
+
+// newKlogVerbosity 使用 registry 将日志级别名称转换为数值，不存在的名称会被忽略并通过 logger 提示
+func newKlogVerbosity(m map[string]klog.Level, registry *LevelRegistry, logger logr.Logger) klogVerbosity {
+	kv := make(klogVerbosity, 0, len(m))
+	for name, v := range m {
+		level, ok := registry.Parse(name)
+		if !ok {
+			logger.Error(fmt.Errorf("%w %q", ErrUnknownLevel, name), "Unknown log level in klog verbosity mapping, ignored")
+			continue
+		}
+		kv = append(kv, klogVerbosityLevel{level: level, v: v})
+	}
+	sort.Slice(kv, func(i, j int) bool { return kv[i].level < kv[j].level })
+	return kv
+}
+
+// verbosity 返回日志级别对应的 V 级别，没有直接配置的级别（如自定义级别）使用比它低的最近一个级别的映射；
+// 比所有配置的级别都低时 ok 为 false
+func (kv klogVerbosity) verbosity(level int) (v klog.Level, ok bool) {
+	for _, l := range kv {
+		if l.level > level {
+			break
+		}
+		v, ok = l.v, true
+	}
+	return v, ok
+}
+
+// KlogV 返回 partName 对应的 klog.Verbose，是否打印只取决于动态日志级别，与 klog 的 -v 无关。
+// 用法：logprint.KlogV("part1", dynamiclog.LogDebugLevel).Info("...")
+func (c *LogController) KlogV(partName string, nowLevel int) klog.Verbose {
+	levels, r := c.partLevel(partName)
+	if c.enabled(levels, partName, r, nowLevel) {
+		return klog.V(0)
+	}
+	return klog.Verbose{}
+}
+
+// KlogVerbose 将 partName 配置的日志级别映射为 klog 的 V 级别（见 WithKlogVerbosity），
+// v 不超过该级别时打印，与 klog 的 -v 无关。
+// 已有的 klog.V(4).Info(...) 改写为 logprint.KlogVerbose("part1", 4).Info(...) 后，即可按 part 动态控制
+func (c *LogController) KlogVerbose(partName string, v klog.Level) klog.Verbose {
+	if c.VerbosityEnabled(partName, int(v)) {
+		return klog.V(0)
+	}
+	return klog.Verbose{}
+}
+
+// VerbosityEnabled 判断 partName 是否打印 V 级别为 v 的日志（klog、logr 的 V 级别），映射见 WithKlogVerbosity。
+// V 级别的日志都是 info 日志，part 配置的级别高于 info 时总是返回 false
+func (c *LogController) VerbosityEnabled(partName string, v int) bool {
+	levels, r := c.partLevel(partName)
+	if !c.cmInfo.registry.Enabled(r.level, LogInfoLevel) {
+		return false
+	}
+	maxV, ok := c.klogVerbosity.verbosity(r.level)
+	return ok && klog.Level(v) <= maxV && levels.allow(r.rule, partName)
+}
@@ -0,0 +1,56 @@
+package dynamiclog
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+func TestVerbosityEnabled(t *testing.T) {
+	c := newTestController()
+	data := "trace: trace\ndebug: debug\ninfo: info\nwarn: warn\nerror: error\noff: off\n"
+	if err := c.parse(c.sources[0], newTestConfigMap("1", data)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		part string
+		v    int
+		want bool
+	}{
+		{"trace", 10, true},
+		{"trace", 11, false},
+		{"debug", 4, true},
+		{"debug", 5, false},
+		{"info", 0, true},
+		{"info", 2, true},
+		{"info", 3, false},
+		// 高于 info 的级别不打印任何 V 级别的日志，包括 V(0)
+		{"warn", 0, false},
+		{"error", 0, false},
+		{"off", 0, false},
+	} {
+		if got := c.VerbosityEnabled(tc.part, tc.v); got != tc.want {
+			t.Errorf("VerbosityEnabled(%q, %d) = %v, want %v", tc.part, tc.v, got, tc.want)
+		}
+		if got := c.KlogVerbose(tc.part, klog.Level(tc.v)).Enabled(); got != tc.want {
+			t.Errorf("KlogVerbose(%q, %d).Enabled() = %v, want %v", tc.part, tc.v, got, tc.want)
+		}
+	}
+}
+
+// TestKlogVerbosityUnknownLevel 映射中不存在的日志级别被忽略，并通过 WithLogger 指定的 logger 提示
+func TestKlogVerbosityUnknownLevel(t *testing.T) {
+	var lines []string
+	c := newTestController(WithLogger(newFuncrLogger(&lines)), WithKlogVerbosity(map[string]klog.Level{"DEBUG": 6, "verbose": 8}))
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "part1: debug\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !c.VerbosityEnabled("part1", 6) || c.VerbosityEnabled("part1", 7) {
+		t.Error("part1 does not use the verbosity of DEBUG")
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], `\"verbose\"`) || !strings.Contains(lines[0], "unknown log level") {
+		t.Errorf("logged %q, want one error about the unknown level verbose", lines)
+	}
+}
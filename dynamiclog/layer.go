@@ -0,0 +1,155 @@
+package dynamiclog
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/client-go/informers"
+	clientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// 日志配置可以分布在多个 configmap 中，如平台维护的集群默认配置、业务团队维护的 namespace 配置，
+// 以及某个 Deployment 单独的配置。通过 WithLayers 指定优先级较低的 configmap，构造函数中的 configmap 优先级最高：
+//
+//	logprint, err := dynamiclog.NewWithClientset(ctx, clientset, "app", "api-log", "log", "info",
+//		dynamiclog.WithLayers(
+//			dynamiclog.ConfigMapLayer{Namespace: "platform", Name: "log-defaults"}, // 集群默认配置，优先级最低
+//			dynamiclog.ConfigMapLayer{Namespace: "app", Name: "app-log"},          // namespace 配置
+//		))
+//
+// 各层按优先级从高到低合并：同名的配置项以优先级高的一层为准，default 使用优先级最高的配置了 default 的一层，
+// rules 依次合并。注意 part 总是先匹配精确名称，因此低优先级中的 part1.cache 不会被高优先级中的 part1 覆盖。
+// GetLogPartEffectiveLevels 返回的 Layer 字段是 part 的日志级别来自哪个 configmap。
+
+// ConfigMapLayer 是 WithLayers 中的一层 configmap
+type ConfigMapLayer struct {
+	Namespace string
+	Name      string
+	LogKey    string                          // 日志配置的 key，为空时与构造函数的 cmLogKey 相同
+	Factory   informers.SharedInformerFactory // 只用于 NewWithSharedInformerFactory，为空时使用构造函数传入的 factory，需要由调用方启动
+	owned     bool                            // Factory 由 NewWithConfigPath 创建，由 LogController 运行和停止
+}
+
+// configMapSource 是一层 configmap 及其 list/watch 状态，c.sources 按优先级从低到高排列
+type configMapSource struct {
+	namespace string
+	name      string
+	logKey    string
+	factory   informers.SharedInformerFactory
+	owned     bool                        // factory 由 LogController 创建，其中的 informer 由 LogController 运行
+	client    clientv1.ConfigMapInterface // Used for clientset mode.
+	lister    v1.ConfigMapLister          // Used for informer mode.
+	informer  cache.SharedIndexInformer
+	watchRev  string            // Used for clientset mode, resourceVersion to resume watching from.
+	base      *revisionedLevels // 最近一次从该 configmap 解析出的配置，由 applyMu 保护
+	parseErr  *LogParseError    // 整个配置无法解析时的错误，由 applyMu 保护
+}
+
+// key 返回 configmap 在 informer 缓存中的 key，也是 EffectiveLevel.Layer 的值
+func (s *configMapSource) key() string {
+	return s.namespace + "/" + s.name
+}
+
+// newSources 按优先级从低到高返回 WithLayers 中的 configmap 和构造函数中的 configmap
+func (c *LogController) newSources(cmNamespace, cmName, cmLogKey string) []*configMapSource {
+	sources := make([]*configMapSource, 0, len(c.opts.layers)+1)
+	for _, layer := range c.opts.layers {
+		logKey := layer.LogKey
+		if logKey == "" {
+			logKey = cmLogKey
+		}
+		sources = append(sources, &configMapSource{namespace: layer.Namespace, name: layer.Name, logKey: logKey, factory: layer.Factory, owned: layer.owned})
+	}
+	sources = append(sources, &configMapSource{namespace: cmNamespace, name: cmName, logKey: cmLogKey})
+	for _, s := range sources {
+		s.base = c.cmInfo.newRevisionedLevels()
+	}
+	return sources
+}
+
+// source 返回 key 对应的 configmap，不是日志配置的 configmap 时返回 nil
+func (c *LogController) source(key string) *configMapSource {
+	for _, s := range c.sources {
+		if s.key() == key {
+			return s
+		}
+	}
+	return nil
+}
+
+// sourceNames 返回所有 configmap 的名称，用于错误信息
+func (c *LogController) sourceNames() string {
+	names := make([]string, 0, len(c.sources))
+	for _, s := range c.sources {
+		names = append(names, s.key())
+	}
+	return strings.Join(names, ", ")
+}
+
+// informers 返回各层 configmap 使用的 informer 及其是否由 LogController 运行，多层共用同一个 factory 时只返回一次
+func (c *LogController) informers() ([]cache.SharedIndexInformer, []bool) {
+	var informers []cache.SharedIndexInformer
+	var owned []bool
+	seen := make(map[cache.SharedIndexInformer]bool)
+	for _, s := range c.sources {
+		if !seen[s.informer] {
+			seen[s.informer] = true
+			informers = append(informers, s.informer)
+			owned = append(owned, s.owned)
+		}
+	}
+	return informers, owned
+}
+
+// mergeLayers 按优先级从高到低合并各层 configmap 解析出的配置，调用方需持有 applyMu。
+// 在 now 已经过期的配置项被跳过，由优先级更低的一层中的配置生效，因此每次到达过期时间都需要重新合并。
+// 合并结果的 revision 为最近一次发生变化的一层（c.changed）的 resourceVersion，LevelChangeEvent 和 LogLevelDiff 中报告的也是这一层
+func (c *LogController) mergeLayers(now time.Time) *revisionedLevels {
+	rl := c.cmInfo.newRevisionedLevels()
+	if c.changed != nil {
+		rl.rev, rl.layer = c.changed.base.rev, c.changed.key()
+	}
+	rl.layerRevs = make(map[string]string, len(c.sources))
+	for i := len(c.sources) - 1; i >= 0; i-- {
+		s := c.sources[i]
+		base := s.base
+		rl.layerRevs[s.key()] = base.rev
+		if rl.defaultLayer == "" && base.defaultLayer != "" {
+			rl.defaultLevel, rl.defaultNum, rl.defaultLayer = base.defaultLevel, base.defaultNum, base.defaultLayer
+		}
+		for _, part := range base.partList {
+			if _, ok := rl.partLevelMap[part]; ok {
+				continue
+			}
+			if until, ok := base.expires[part]; ok && !now.Before(until) {
+				continue
+			}
+			// selector 在解析 configmap 时已经检查过
+			_ = rl.selectors.compile(part)
+			rl.set(part, base.partLevelMap[part], base.partLevels[part])
+			rl.layers[part] = s.key()
+			if until, ok := base.expires[part]; ok {
+				rl.expires[part] = until
+			}
+			rl.copyPartState(base, part)
+		}
+		rl.rules = append(rl.rules, base.rules...)
+	}
+	rl.selectors.build(rl.partList)
+	return rl
+}
+
+// storeParseErrs 按优先级从低到高记录各层 configmap 最近一次解析时的错误，调用方需持有 applyMu
+func (c *LogController) storeParseErrs() {
+	var errs []*LogParseError
+	for _, s := range c.sources {
+		if s.parseErr != nil {
+			errs = append(errs, s.parseErr)
+		} else {
+			errs = append(errs, s.base.errs...)
+		}
+	}
+	c.cmInfo.parseErrs.Store(errs)
+}
@@ -0,0 +1,79 @@
+package dynamiclog
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPlatformConfigMap(rev, data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "log-defaults", ResourceVersion: rev},
+		Data:       map[string]string{"log": data},
+	}
+}
+
+// TestExpiredLayerFallsBackToLowerLayer 高优先级一层中的配置项过期后使用低优先级一层的配置，而不是默认级别
+func TestExpiredLayerFallsBackToLowerLayer(t *testing.T) {
+	c := newTestController(WithLayers(ConfigMapLayer{Namespace: "platform", Name: "log-defaults"}))
+	t.Cleanup(c.Stop)
+	platform, app := c.sources[0], c.sources[1]
+	if err := c.parse(platform, newPlatformConfigMap("5", "part1: warn\npart2: error\n")); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	soon := time.Now().Add(3 * time.Second).UTC().Format(time.RFC3339)
+	if err := c.parse(app, newTestConfigMap("10", "part1: debug until="+past+"\npart2: debug until="+soon+"\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.GetLogPartLevel("part1"); got != LogWarnLevel {
+		t.Errorf("GetLogPartLevel(part1) = %d, want warn of the platform layer", got)
+	}
+	if got := c.GetLogPartEffectiveLevels()["part1"].Layer; got != "platform/log-defaults" {
+		t.Errorf("layer of part1 = %q, want platform/log-defaults", got)
+	}
+	if got := c.GetLogPartLevel("part2"); got != LogDebugLevel {
+		t.Errorf("GetLogPartLevel(part2) = %d before it expires, want debug", got)
+	}
+	// 到达过期时间时重新合并，part2 恢复为 platform 中的 error
+	waitForLevel(t, c, "part2", "error")
+}
+
+// TestLayerChangeReportsResourceVersion 多层配置时事件和 diff 中报告发生变化的那一层的 resourceVersion
+func TestLayerChangeReportsResourceVersion(t *testing.T) {
+	c := newTestController(WithLayers(ConfigMapLayer{Namespace: "platform", Name: "log-defaults"}))
+	platform, app := c.sources[0], c.sources[1]
+	if err := c.parse(platform, newPlatformConfigMap("5", "part1: info\npart2: info\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.parse(app, newTestConfigMap("10", "part1: debug\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []LevelChangeEvent
+	c.OnLevelChange(func(ev LevelChangeEvent) { events = append(events, ev) })
+	if err := c.parse(platform, newPlatformConfigMap("6", "part1: info\npart2: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := LevelChangeEvent{PartName: "part2", OldLevel: "info", NewLevel: "warn", ResourceVersion: "6", Layer: "platform/log-defaults"}
+	if len(events) != 1 || events[0] != want {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	diff := c.GetLogPartLevelDiff()
+	if diff.Layer != "platform/log-defaults" || diff.OldRevision != "5" || diff.NewRevision != "6" {
+		t.Errorf("diff = %+v, want platform/log-defaults 5 -> 6", diff)
+	}
+
+	if err := c.parse(app, newTestConfigMap("11", "part1: trace\n")); err != nil {
+		t.Fatal(err)
+	}
+	if diff := c.GetLogPartLevelDiff(); diff.Layer != "default/log-set" || diff.OldRevision != "10" || diff.NewRevision != "11" {
+		t.Errorf("diff = %+v, want default/log-set 10 -> 11", diff)
+	}
+	if ev := events[len(events)-1]; ev.ResourceVersion != "11" || ev.Layer != "default/log-set" {
+		t.Errorf("last event = %+v, want resourceVersion 11 of default/log-set", ev)
+	}
+}
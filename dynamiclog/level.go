@@ -0,0 +1,106 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LevelRegistry 保存日志级别名称与数值的映射，configmap 中日志级别的解析和 EnableLogPrint 中的比较都基于该数值。
+// 名称不区分大小写，configmap 中也可以直接写数值（如 part1: 3）。
+// LevelRegistry 不是并发安全的，应在传给构造函数（WithLevelRegistry）之前完成注册，构造函数会复制一份。
+type LevelRegistry struct {
+	levels map[string]int // 大写名称（含别名） -> 数值
+	names  map[int]string // 数值 -> 注册时的名称，不包括别名
+	off    int            // OFF 对应的数值，配置为该级别及以上的 part 不打印任何日志
+}
+
+// NewLevelRegistry 创建包含内置日志级别的 LevelRegistry：
+// TRACE(0) < DEBUG(1) < INFO(2) < WARN(3) < ERROR(4) < FATAL(5) < OFF(6)，
+// 以及别名 WARNING -> WARN、ERR -> ERROR
+func NewLevelRegistry() *LevelRegistry {
+	r := &LevelRegistry{levels: make(map[string]int), names: make(map[int]string)}
+	for name, level := range LogLevelMap {
+		r.Register(name, level)
+	}
+	r.Alias("WARNING", "WARN")
+	r.Alias("ERR", "ERROR")
+	return r
+}
+
+// Register 注册自定义日志级别，已存在的名称会被覆盖
+func (r *LevelRegistry) Register(name string, level int) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if old, ok := r.levels[name]; ok && r.names[old] == name {
+		delete(r.names, old)
+	}
+	r.levels[name] = level
+	if name == "OFF" {
+		r.off = level
+	}
+	if _, ok := r.names[level]; !ok {
+		r.names[level] = name
+	}
+}
+
+// Alias 为已注册的日志级别 name 增加别名
+func (r *LevelRegistry) Alias(alias, name string) error {
+	level, ok := r.levels[strings.ToUpper(strings.TrimSpace(name))]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownLevel, name)
+	}
+	r.levels[strings.ToUpper(strings.TrimSpace(alias))] = level
+	return nil
+}
+
+// Parse 返回日志级别名称（或别名、数值）对应的数值，不存在时 ok 为 false
+func (r *LevelRegistry) Parse(level string) (int, bool) {
+	level = strings.TrimSpace(level)
+	if levelNum, ok := r.levels[strings.ToUpper(level)]; ok {
+		return levelNum, true
+	}
+	if levelNum, err := strconv.Atoi(level); err == nil {
+		return levelNum, true
+	}
+	return 0, false
+}
+
+// Enabled 判断配置为 configured 级别的 part 是否打印 level 级别的日志
+func (r *LevelRegistry) Enabled(configured, level int) bool {
+	return configured < r.off && level >= configured
+}
+
+// Name 返回数值对应的日志级别名称，没有注册时返回数值本身
+func (r *LevelRegistry) Name(level int) string {
+	if name, ok := r.names[level]; ok {
+		return name
+	}
+	return strconv.Itoa(level)
+}
+
+// Levels 返回按数值从小到大排序的日志级别名称，不包括别名
+func (r *LevelRegistry) Levels() []string {
+	levels := make([]int, 0, len(r.names))
+	for level := range r.names {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	names := make([]string, 0, len(levels))
+	for _, level := range levels {
+		names = append(names, r.names[level])
+	}
+	return names
+}
+
+// clone 复制 LevelRegistry，避免构造之后调用方的修改影响 LogController
+func (r *LevelRegistry) clone() *LevelRegistry {
+	c := &LevelRegistry{levels: make(map[string]int, len(r.levels)), names: make(map[int]string, len(r.names)), off: r.off}
+	for name, level := range r.levels {
+		c.levels[name] = level
+	}
+	for level, name := range r.names {
+		c.names[level] = name
+	}
+	return c
+}
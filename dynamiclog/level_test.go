@@ -0,0 +1,117 @@
+package dynamiclog
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLevelRegistryParse(t *testing.T) {
+	r := NewLevelRegistry()
+	r.Register("VERBOSE", 0)  // 与 TRACE 数值相同，Name(0) 仍为 TRACE
+	r.Register("NOTICE", 250) // 被下面的 Register 覆盖
+	r.Register("notice", 25)
+	if name := r.Name(0); name != "TRACE" {
+		t.Errorf("Name(0) = %q, want TRACE", name)
+	}
+	if name := r.Name(250); name != "250" {
+		t.Errorf("Name(250) = %q after NOTICE is registered again, want 250", name)
+	}
+	if err := r.Alias("chatty", "verbose"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Alias("x", "nope"); !errors.Is(err, ErrUnknownLevel) {
+		t.Errorf("Alias of an unknown level: err = %v, want ErrUnknownLevel", err)
+	}
+
+	for _, tc := range []struct {
+		level string
+		want  int
+		ok    bool
+	}{
+		{"debug", LogDebugLevel, true},
+		{" Info ", LogInfoLevel, true},
+		{"warning", LogWarnLevel, true},
+		{"ERR", LogErrorLevel, true},
+		{"trace", LogTraceLevel, true},
+		{"off", LogOffLevel, true},
+		{"3", 3, true},
+		{"-1", -1, true},
+		{"notice", 25, true},
+		{"Chatty", 0, true},
+		{"dbug", 0, false},
+		{"", 0, false},
+		{"3.5", 0, false},
+	} {
+		got, ok := r.Parse(tc.level)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Parse(%q) = %d, %v, want %d, %v", tc.level, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestLevelRegistryCustomLevels(t *testing.T) {
+	// 在内置级别之间插入自定义级别：数值放大后 NOTICE 位于 INFO 和 WARN 之间
+	r := &LevelRegistry{levels: make(map[string]int), names: make(map[int]string)}
+	for name, level := range map[string]int{"TRACE": 0, "DEBUG": 10, "INFO": 20, "NOTICE": 25, "WARN": 30, "ERROR": 40, "FATAL": 50, "OFF": 60} {
+		r.Register(name, level)
+	}
+	want := []string{"TRACE", "DEBUG", "INFO", "NOTICE", "WARN", "ERROR", "FATAL", "OFF"}
+	if got := r.Levels(); len(got) != len(want) {
+		t.Fatalf("Levels() = %v, want %v", got, want)
+	} else {
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("Levels() = %v, want %v", got, want)
+			}
+		}
+	}
+	if name := r.Name(25); name != "NOTICE" {
+		t.Errorf("Name(25) = %q, want NOTICE", name)
+	}
+	if name := r.Name(26); name != "26" {
+		t.Errorf("Name(26) = %q, want 26", name)
+	}
+
+	notice, _ := r.Parse("notice")
+	info, _ := r.Parse("info")
+	warn, _ := r.Parse("warn")
+	if !r.Enabled(notice, warn) || r.Enabled(notice, info) || !r.Enabled(info, notice) {
+		t.Error("NOTICE should be between INFO and WARN")
+	}
+}
+
+func TestLevelRegistryEnabled(t *testing.T) {
+	r := NewLevelRegistry()
+	for _, tc := range []struct {
+		configured, level int
+		want              bool
+	}{
+		{LogInfoLevel, LogDebugLevel, false},
+		{LogInfoLevel, LogInfoLevel, true},
+		{LogInfoLevel, LogFatalLevel, true},
+		{LogTraceLevel, LogTraceLevel, true},
+		{LogFatalLevel, LogFatalLevel, true},
+		// 配置为 OFF 及以上时不打印任何日志，即使日志级别也是 OFF 或更高
+		{LogOffLevel, LogFatalLevel, false},
+		{LogOffLevel, LogOffLevel, false},
+		{LogOffLevel + 1, LogOffLevel + 1, false},
+	} {
+		if got := r.Enabled(tc.configured, tc.level); got != tc.want {
+			t.Errorf("Enabled(%d, %d) = %v, want %v", tc.configured, tc.level, got, tc.want)
+		}
+	}
+}
+
+// TestLevelRegistryCloned 构造函数复制 LevelRegistry，之后的修改不影响 LogController
+func TestLevelRegistryCloned(t *testing.T) {
+	r := NewLevelRegistry()
+	r.Register("NOTICE", LogWarnLevel)
+	c := newTestController(WithLevelRegistry(r))
+	r.Register("NOTICE", LogDebugLevel)
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "part1: notice\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetLogPartLevel("part1"); got != LogWarnLevel {
+		t.Errorf("GetLogPartLevel(part1) = %d, want %d", got, LogWarnLevel)
+	}
+}
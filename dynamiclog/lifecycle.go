@@ -0,0 +1,174 @@
+package dynamiclog
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Start 启动后台 goroutine，并阻塞到首次加载 configmap 完成，ctx 只限制等待的时间。
+// 构造函数已经调用过 Start，重复调用只会等待首次加载完成。
+// 启动失败时 LogController 会被停止，之后调用 Start 返回 ErrStopped。
+func (c *LogController) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.ctx.Err() != nil {
+		c.mu.Unlock()
+		return ErrStopped
+	}
+	if c.started {
+		c.mu.Unlock()
+		return c.WaitForSync(ctx)
+	}
+	c.started = true
+	c.mu.Unlock()
+
+	var err error
+	if c.sources[0].client != nil {
+		err = c.startClientset()
+	} else {
+		err = c.startInformer(ctx)
+	}
+	if err != nil {
+		c.Stop()
+		return err
+	}
+	c.spawn(c.reportSuppressed)
+	close(c.synced)
+	return nil
+}
+
+// WaitForSync 等待首次加载 configmap 完成，ctx 结束时返回 ctx.Err()，LogController 已停止时返回 ErrStopped
+func (c *LogController) WaitForSync(ctx context.Context) error {
+	select {
+	case <-c.synced:
+		return nil
+	case <-c.ctx.Done():
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop 停止 LogController 启动的所有 goroutine 并等待其退出，可以重复调用。
+// 之后日志级别保持为停止前的状态，不再随 configmap 变化。
+// 在 OnLevelChange 的回调中调用时不等待 goroutine 退出（回调可能正运行在其中），它们在回调返回后退出。
+func (c *LogController) Stop() {
+	c.mu.Lock()
+	c.cancel()
+	c.mu.Unlock()
+	c.applyMu.Lock()
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+	}
+	c.applyMu.Unlock()
+	if c.queue != nil {
+		c.queue.ShutDown()
+	}
+	if c.handlers.isNotifying() {
+		return
+	}
+	c.wg.Wait()
+}
+
+// spawn 启动受 Stop 管理的 goroutine，LogController 已停止时不启动并返回 false
+func (c *LogController) spawn(fn func()) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return false
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// startInformer 启动 informer 并加载已存在的各层 configmap。
+// 只运行 LogController 自己创建的 factory 中的 informer，并在 Stop 时停止；调用方传入的 factory 由调用方启动和停止，
+// 否则 Stop 会停止其他使用者共享的 informer，且之后的 factory.Start 也无法再次启动它。
+func (c *LogController) startInformer(ctx context.Context) error {
+	informers, owned := c.informers()
+	hasSynced := make([]cache.InformerSynced, 0, len(informers))
+	for i, informer := range informers {
+		informer := informer
+		if owned[i] && !informerStarted(informer) {
+			c.spawn(func() { informer.Run(c.ctx.Done()) })
+		}
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
+
+	// 等待缓存同步，Start 的 ctx 结束、超时或 Stop 都会停止等待
+	syncCtx, cancel := context.WithTimeout(ctx, c.opts.syncTimeout)
+	defer cancel()
+	stopCh := make(chan struct{})
+	go func() {
+		defer close(stopCh)
+		select {
+		case <-syncCtx.Done():
+		case <-c.ctx.Done():
+		}
+	}()
+	if !cache.WaitForCacheSync(stopCh, hasSynced...) {
+		for i, informer := range informers {
+			if !owned[i] && !informerStarted(informer) {
+				return fmt.Errorf("%w: %s: configmap informer of the shared informer factory is not started, "+
+					"call factory.Core().V1().ConfigMaps().Informer() before factory.Start", ErrCacheSyncTimeout, c.sourceNames())
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrCacheSyncTimeout, c.sourceNames())
+	}
+
+	for _, s := range c.sources {
+		existingConfig, err := s.lister.ConfigMaps(s.namespace).Get(s.name)
+		if err == nil {
+			// 解析失败时以默认级别启动，由队列退避重试
+			if err := c.parse(s, existingConfig); err != nil {
+				c.opts.logger.Error(err, "Parse configmap failed, start with the default log level")
+			}
+		} else if !apierrors.IsNotFound(err) || !c.opts.defaultsIfMissing {
+			return wrapAPIError(err, s.namespace, s.name)
+		}
+	}
+
+	// Stop 后关闭队列，使 runWithInformer 退出，之后的事件会被队列忽略
+	if !c.spawn(func() {
+		<-c.ctx.Done()
+		c.queue.ShutDown()
+	}) || !c.spawn(c.runWithInformer) {
+		return ErrStopped
+	}
+	return nil
+}
+
+// startClientset 加载已存在的各层 configmap 并分别开始 watch
+func (c *LogController) startClientset() error {
+	for _, s := range c.sources {
+		found, err := c.list(s)
+		if err != nil {
+			return wrapAPIError(err, s.namespace, s.name)
+		}
+		if !found && !c.opts.defaultsIfMissing {
+			return fmt.Errorf("%w: %s/%s", ErrConfigMapNotFound, s.namespace, s.name)
+		}
+	}
+
+	for _, s := range c.sources {
+		s := s
+		if !c.spawn(func() { c.runWithClientset(s) }) {
+			return ErrStopped
+		}
+	}
+	return nil
+}
+
+// informerStarted 判断 informer 是否已经运行（如 factory 已经 Start），避免重复运行
+func informerStarted(informer cache.SharedIndexInformer) bool {
+	if s, ok := informer.(interface{ HasStarted() bool }); ok {
+		return s.HasStarted()
+	}
+	return false
+}
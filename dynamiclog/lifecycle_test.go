@@ -0,0 +1,90 @@
+package dynamiclog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestStopOwnedInformerNoLeak LogController 自己创建的 factory 中的 informer 在 Stop 后退出
+func TestStopOwnedInformerNoLeak(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	cs := fake.NewSimpleClientset(newTestConfigMap("10", "part1: debug"))
+	factory := NewConfigMapInformerFactory(cs, "default", "log-set")
+	l, err := newWithInformerFactory(context.Background(), factory, true, "default", "log-set", "log", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForLevel(t, l, "part1", "debug")
+	l.Stop()
+}
+
+// TestStopKeepsSharedInformerRunning 调用方的 factory 在 Stop 后继续运行，由调用方停止
+func TestStopKeepsSharedInformerRunning(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	cs := fake.NewSimpleClientset(newTestConfigMap("10", "part1: debug"))
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	lister := factory.Core().V1().ConfigMaps().Lister()
+	stopCh := make(chan struct{})
+	factory.Start(stopCh)
+	defer close(stopCh)
+
+	l, err := NewWithSharedInformerFactory(context.Background(), factory, "default", "log-set", "log", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForLevel(t, l, "part1", "debug")
+	l.Stop()
+
+	// Stop 之后其他使用者仍然能收到 configmap 的变化
+	if _, err := cs.CoreV1().ConfigMaps("default").Update(context.Background(), newTestConfigMap("11", "part1: warn"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cm, err := lister.ConfigMaps("default").Get("log-set")
+		if err == nil && cm.ResourceVersion == "11" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("shared informer stopped with the LogController")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := l.GetLogPartLevelMap()["part1"]; got != "debug" {
+		t.Errorf("level of part1 = %q after Stop, want debug", got)
+	}
+}
+
+// TestSharedFactoryNotStarted 调用方的 factory 没有启动时 LogController 不会运行其中的 informer
+func TestSharedFactoryNotStarted(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	cs := fake.NewSimpleClientset(newTestConfigMap("10", "part1: debug"))
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	_, err := NewWithSharedInformerFactory(context.Background(), factory, "default", "log-set", "log", "info",
+		WithSyncTimeout(100*time.Millisecond))
+	if !errors.Is(err, ErrCacheSyncTimeout) {
+		t.Fatalf("err = %v, want ErrCacheSyncTimeout", err)
+	}
+	if informerStarted(factory.Core().V1().ConfigMaps().Informer()) {
+		t.Error("informer of the caller's factory was started by the LogController")
+	}
+}
+
+// TestStopClientsetNoLeak clientset 模式的 list/watch goroutine 在 Stop 后退出
+func TestStopClientsetNoLeak(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	h, l := newWatchHarness(t, newTestConfigMap("10", "part1: debug"))
+	h.nextWatch(t, "10")
+	l.Stop()
+}
@@ -0,0 +1,192 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 处于 debug 的 part 在热点循环中可能每秒打印大量日志，可以为配置项设置限速和采样：
+//
+//	part1: debug rate=100/s burst=500        # 每秒最多 100 条，允许突发 500 条，单位可以是 s、m、h
+//	part2: debug first=10 thereafter=100     # 每秒前 10 条都打印，之后每 100 条打印 1 条
+//
+// 两者可以同时使用，在 EnableLogPrint 等判断中生效，被限制的日志数会定期打印。
+// 规则配置在上级、glob 或正则上时，命中的每个 part 分别计数，互不占用额度。
+
+// limitSpec 是配置项的限速和采样规则，规则不变时复用 ruleLimiter 以保留计数
+type limitSpec struct {
+	rate       float64 // 每秒的日志数，0 表示不限速
+	burst      int
+	first      int64 // 每秒前 first 条都打印
+	thereafter int64 // 之后每 thereafter 条打印 1 条，0 表示都不打印
+}
+
+func (s limitSpec) enabled() bool {
+	return s.rate > 0 || s.first > 0 || s.thereafter > 0
+}
+
+// ruleLimiter 记录命中某个配置项的各个 part 的限速和采样状态，可以并发调用
+type ruleLimiter struct {
+	spec     limitSpec
+	parts    sync.Map // map[string]*partLimiter
+	n        atomic.Int32
+	overflow *partLimiter // part 数量达到 maxResolvedParts 之后，其余的 part 共用的状态
+}
+
+func newRuleLimiter(spec limitSpec) *ruleLimiter {
+	return &ruleLimiter{spec: spec, overflow: newPartLimiter(spec)}
+}
+
+// part 返回 partName 的 partLimiter，避免 part 名称不断变化时无限增长，最多为 maxResolvedParts 个 part 分别计数
+func (r *ruleLimiter) part(partName string) *partLimiter {
+	if l, ok := r.parts.Load(partName); ok {
+		return l.(*partLimiter)
+	}
+	if r.n.Load() >= maxResolvedParts {
+		return r.overflow
+	}
+	l, loaded := r.parts.LoadOrStore(partName, newPartLimiter(r.spec))
+	if !loaded {
+		r.n.Add(1)
+	}
+	return l.(*partLimiter)
+}
+
+// takeSuppressed 返回并清零各个 part 上次报告之后被限制的日志数，rule 表示共用 overflow 的 part
+func (r *ruleLimiter) takeSuppressed(rule string) map[string]int64 {
+	m := make(map[string]int64)
+	r.parts.Range(func(k, v interface{}) bool {
+		if n := v.(*partLimiter).suppressed.Swap(0); n > 0 {
+			m[k.(string)] = n
+		}
+		return true
+	})
+	if n := r.overflow.suppressed.Swap(0); n > 0 {
+		m[rule] += n
+	}
+	return m
+}
+
+// partLimiter 记录某个 part 的限速和采样状态，可以并发调用
+type partLimiter struct {
+	spec       limitSpec
+	limiter    *rate.Limiter // 为 nil 时不限速
+	window     atomic.Int64  // 采样计数所在的秒
+	count      atomic.Int64  // window 内的日志数
+	suppressed atomic.Int64  // 上次报告之后被限制的日志数
+}
+
+func newPartLimiter(spec limitSpec) *partLimiter {
+	l := &partLimiter{spec: spec}
+	if spec.rate > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(spec.rate), spec.burst)
+	}
+	return l
+}
+
+// allow 判断是否打印，不打印时计入 suppressed
+func (l *partLimiter) allow(now time.Time) bool {
+	if l.spec.first > 0 || l.spec.thereafter > 0 {
+		sec := now.Unix()
+		if window := l.window.Load(); window != sec && l.window.CompareAndSwap(window, sec) {
+			l.count.Store(0)
+		}
+		n := l.count.Add(1)
+		if n > l.spec.first && (l.spec.thereafter == 0 || (n-l.spec.first)%l.spec.thereafter != 0) {
+			l.suppressed.Add(1)
+			return false
+		}
+	}
+	if l.limiter != nil && !l.limiter.AllowN(now, 1) {
+		l.suppressed.Add(1)
+		return false
+	}
+	return true
+}
+
+// allow 按 rule 的限速和采样规则判断 partName 是否打印，没有配置时不需要获取当前时间
+func (rl *revisionedLevels) allow(rule, partName string) bool {
+	l, ok := rl.limits[rule]
+	if !ok {
+		return true
+	}
+	return l.part(partName).allow(time.Now())
+}
+
+// ruleLimiter 返回配置项 part 的 ruleLimiter，规则与 rl 中的相同时复用，保留各个 part 的计数
+func (rl *revisionedLevels) ruleLimiter(part string, spec limitSpec) *ruleLimiter {
+	if l, ok := rl.limits[part]; ok && l.spec == spec {
+		return l
+	}
+	return newRuleLimiter(spec)
+}
+
+// limitSpec 返回 rate=、burst=、first=、thereafter= 指定的规则
+func (pc PartConfig) limitSpec() (limitSpec, error) {
+	spec := limitSpec{burst: pc.Burst, first: int64(pc.First), thereafter: int64(pc.Thereafter)}
+	if pc.Burst < 0 || pc.First < 0 || pc.Thereafter < 0 {
+		return limitSpec{}, fmt.Errorf("%w: negative burst, first or thereafter", ErrInvalidLimit)
+	}
+	if pc.Rate == "" {
+		if pc.Burst > 0 {
+			return limitSpec{}, fmt.Errorf("%w: burst without rate", ErrInvalidLimit)
+		}
+		return spec, nil
+	}
+
+	num, unit, _ := strings.Cut(pc.Rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 {
+		return limitSpec{}, fmt.Errorf("%w %q", ErrInvalidLimit, "rate="+pc.Rate)
+	}
+	switch unit {
+	case "", "s":
+		spec.rate = n
+	case "m":
+		spec.rate = n / 60
+	case "h":
+		spec.rate = n / 3600
+	default:
+		return limitSpec{}, fmt.Errorf("%w %q", ErrInvalidLimit, "rate="+pc.Rate)
+	}
+	if spec.burst == 0 {
+		spec.burst = int(math.Max(1, math.Ceil(n)))
+	}
+	return spec, nil
+}
+
+// reportSuppressed 定期打印每个 part 被限制的日志数
+func (c *LogController) reportSuppressed() {
+	ticker := time.NewTicker(c.opts.suppressedReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		suppressed := make(map[string]int64)
+		for rule, l := range c.cmInfo.load().limits {
+			for part, n := range l.takeSuppressed(rule) {
+				suppressed[part] += n
+			}
+		}
+		parts := make([]string, 0, len(suppressed))
+		for part := range suppressed {
+			parts = append(parts, part)
+		}
+		sort.Strings(parts)
+		for _, part := range parts {
+			n := suppressed[part]
+			c.opts.logger.Info(fmt.Sprintf("%d messages suppressed for %s", n, part), "part", part, "suppressed", n)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package dynamiclog
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+)
+
+// countEnabled 返回 n 次 EnableLogPrint 中打印的次数
+func countEnabled(c *LogController, part string, n int) int {
+	enabled := 0
+	for i := 0; i < n; i++ {
+		if c.EnableLogPrint(part, LogDebugLevel) == LogEnable {
+			enabled++
+		}
+	}
+	return enabled
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "part1: debug rate=1/m burst=3\npart2: debug\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := countEnabled(c, "part1", 10); got != 3 {
+		t.Errorf("part1 printed %d of 10 logs, want the burst 3", got)
+	}
+	if got := countEnabled(c, "part2", 10); got != 10 {
+		t.Errorf("part2 without limits printed %d of 10 logs", got)
+	}
+
+	// 规则不变时保留计数，修改规则后重新计数
+	if err := c.parse(c.sources[0], newTestConfigMap("2", "part1: debug rate=1/m burst=3\npart2: info\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := countEnabled(c, "part1", 1); got != 0 {
+		t.Error("burst of part1 is reset by an unrelated change")
+	}
+	if err := c.parse(c.sources[0], newTestConfigMap("3", "part1: debug rate=1/m burst=5\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := countEnabled(c, "part1", 10); got != 5 {
+		t.Errorf("part1 printed %d of 10 logs after the burst changes, want 5", got)
+	}
+}
+
+func TestSamplingFirstThereafter(t *testing.T) {
+	l := newPartLimiter(limitSpec{first: 2, thereafter: 3})
+	now := time.Unix(1000, 0)
+	var allowed []int
+	for i := 1; i <= 10; i++ {
+		if l.allow(now) {
+			allowed = append(allowed, i)
+		}
+	}
+	// 前 2 条，之后每 3 条打印 1 条
+	if want := []int{1, 2, 5, 8}; len(allowed) != len(want) || allowed[2] != 5 || allowed[3] != 8 {
+		t.Errorf("allowed %v, want %v", allowed, want)
+	}
+	if n := l.suppressed.Load(); n != 6 {
+		t.Errorf("suppressed = %d, want 6", n)
+	}
+	// 下一秒重新计数
+	if !l.allow(now.Add(time.Second)) {
+		t.Error("the first log of the next second is suppressed")
+	}
+}
+
+// TestLimitPerPart 配置在 selector 上的限速，命中的每个 part 各自计数
+func TestLimitPerPart(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl.*: debug rate=1/m burst=2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := countEnabled(c, "ctl.a", 5); got != 2 {
+		t.Errorf("ctl.a printed %d of 5 logs, want 2", got)
+	}
+	if got := countEnabled(c, "ctl.b", 5); got != 2 {
+		t.Errorf("ctl.b printed %d of 5 logs, want its own burst 2", got)
+	}
+}
+
+func TestSuppressedReport(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, args)
+	}, funcr.Options{})
+	c := newTestController(WithLogger(logger), WithSuppressedReportInterval(10*time.Millisecond))
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl.*: debug rate=1/m burst=2\n")); err != nil {
+		t.Fatal(err)
+	}
+	countEnabled(c, "ctl.a", 5)
+	countEnabled(c, "ctl.b", 3)
+	c.spawn(c.reportSuppressed)
+	t.Cleanup(c.Stop)
+
+	want := []string{`"3 messages suppressed for ctl.a"`, `"1 messages suppressed for ctl.b"`}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		got := strings.Join(lines, "\n")
+		mu.Unlock()
+		if strings.Contains(got, want[0]) && strings.Contains(got, want[1]) {
+			if strings.Contains(got, "ctl.*") {
+				t.Errorf("report names the rule: %s", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reported %q, want %q", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+package dynamiclog
+
+import (
+	"github.com/go-logr/logr"
+)
+
+// logSink 包装任意 logr.LogSink，按 configmap 中 part 的动态日志级别过滤日志
+type logSink struct {
+	c    LogInterface
+	sink logr.LogSink
+	part string // WithName 指定的名称，多次调用时以 “.” 连接
+}
+
+var _ logr.CallDepthLogSink = &logSink{}
+
+// NewLogSink 返回包装 sink 的 logr.LogSink：WithName("part") 指定 part（多次 WithName 以 “.” 连接，对应分层的 part），
+// Enabled(v) 按 part 配置的日志级别映射的 V 级别判断（与 KlogVerbose 相同，见 WithKlogVerbosity），Error 在 part 的级别不高于 error 时打印。
+// 过滤由 dynamiclog 完成，sink 应配置为打印所有 V 级别的日志，并且来自已有的 logr.Logger（logger.GetSink()），由该 Logger 完成初始化。
+// 用法：log := logr.New(dynamiclog.NewLogSink(logprint, logger.GetSink())).WithName("part1")，之后 log.V(1).Info(...) 即受 configmap 控制
+func NewLogSink(c LogInterface, sink logr.LogSink) logr.LogSink {
+	// 加上 logSink 多出的一层调用，WithCallDepth 返回新的 sink，不影响原来的 logger
+	if cd, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = cd.WithCallDepth(1)
+	}
+	return &logSink{c: c, sink: sink}
+}
+
+// Init 不调用被包装的 sink 的 Init：它已经由创建它的 logr.Logger 初始化，再次调用会修改原来 logger 的调用层数
+func (s *logSink) Init(logr.RuntimeInfo) {}
+
+func (s *logSink) Enabled(level int) bool {
+	return s.c.VerbosityEnabled(s.part, level)
+}
+
+func (s *logSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.sink.Info(level, msg, keysAndValues...)
+}
+
+func (s *logSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if s.c.EnableLogPrint(s.part, LogErrorLevel) != LogEnable {
+		return
+	}
+	s.sink.Error(err, msg, keysAndValues...)
+}
+
+func (s *logSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &logSink{c: s.c, sink: s.sink.WithValues(keysAndValues...), part: s.part}
+}
+
+func (s *logSink) WithName(name string) logr.LogSink {
+	part := name
+	if s.part != "" {
+		part = s.part + "." + name
+	}
+	return &logSink{c: s.c, sink: s.sink.WithName(name), part: part}
+}
+
+func (s *logSink) WithCallDepth(depth int) logr.LogSink {
+	sink, ok := s.sink.(logr.CallDepthLogSink)
+	if !ok {
+		return s
+	}
+	return &logSink{c: s.c, sink: sink.WithCallDepth(depth), part: s.part}
+}
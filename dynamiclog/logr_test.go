@@ -0,0 +1,78 @@
+package dynamiclog
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+)
+
+// newFuncrLogger 返回打印所有 V 级别并记录调用位置的 logr.Logger，输出追加到 lines
+func newFuncrLogger(lines *[]string) logr.Logger {
+	return funcr.New(func(prefix, args string) {
+		*lines = append(*lines, prefix+" "+args)
+	}, funcr.Options{LogCaller: funcr.All, Verbosity: 10})
+}
+
+// callerOfPrevLine 返回调用处上一行的位置，与 funcr 的 caller 字段格式相同
+func callerOfPrevLine() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf(`"file":"%s","line":%d`, file[strings.LastIndex(file, "/")+1:], line-1)
+}
+
+func TestLogSinkFiltersByPart(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl: debug\nctl.cache: error\n")); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	log := logr.New(NewLogSink(c, newFuncrLogger(&lines).GetSink()))
+
+	log.WithName("ctl").V(4).Info("debug of ctl")          // debug 映射为 V(4)，打印
+	log.WithName("ctl").V(5).Info("trace of ctl")          // 不打印
+	log.WithName("ctl").WithName("cache").Info("info")     // ctl.cache 为 error，V(0) 也不打印
+	log.WithName("ctl").WithName("cache").Error(nil, "er") // 打印
+	log.WithName("other").V(2).Info("info of other")       // 默认 info 映射为 V(2)，打印
+	if want := []string{"debug of ctl", "er", "info of other"}; len(lines) != len(want) {
+		t.Fatalf("logged %q, want %q", lines, want)
+	} else {
+		for i := range want {
+			if !strings.Contains(lines[i], want[i]) {
+				t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+			}
+		}
+	}
+	if !strings.HasPrefix(lines[1], "ctl/cache ") {
+		t.Errorf("line %q should keep the logger name ctl/cache", lines[1])
+	}
+}
+
+// TestLogSinkCallerDepth 包装后的 logger 和原来的 logger 都报告调用方的位置
+func TestLogSinkCallerDepth(t *testing.T) {
+	c := newTestController()
+	var lines []string
+	logger := newFuncrLogger(&lines)
+	wrapped := logr.New(NewLogSink(c, logger.GetSink()))
+
+	logger.Info("before")
+	want := []string{callerOfPrevLine()}
+	wrapped.Info("wrapped")
+	want = append(want, callerOfPrevLine())
+	wrapped.Error(errors.New("boom"), "wrapped error")
+	want = append(want, callerOfPrevLine())
+	logger.Info("after")
+	want = append(want, callerOfPrevLine())
+
+	if len(lines) != len(want) {
+		t.Fatalf("logged %q", lines)
+	}
+	for i := range want {
+		if !strings.Contains(lines[i], want[i]) {
+			t.Errorf("line %d = %q, want caller %s", i, lines[i], want[i])
+		}
+	}
+}
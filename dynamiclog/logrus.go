@@ -0,0 +1,50 @@
+package dynamiclog
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logrusFormatter 包装任意 logrus.Formatter，按 entry 中 part 字段的动态日志级别过滤日志
+type logrusFormatter struct {
+	c         LogInterface
+	formatter logrus.Formatter
+}
+
+// NewLogrusFormatter 返回包装 formatter 的 logrus.Formatter：part 来自 entry 的 PartKey 字段（logger.WithField("part", "cache")），
+// 不打印的日志格式化为空，不会写入 logger.Out。
+// 过滤由 dynamiclog 在格式化时完成，logger 的级别应设置为 logrus.TraceLevel；hook 仍会收到被过滤的日志。
+// 用法：logger.SetFormatter(dynamiclog.NewLogrusFormatter(logprint, &logrus.TextFormatter{}))
+func NewLogrusFormatter(c LogInterface, formatter logrus.Formatter) logrus.Formatter {
+	return &logrusFormatter{c: c, formatter: formatter}
+}
+
+func (f *logrusFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var part string
+	if v, ok := entry.Data[PartKey]; ok {
+		part = fmt.Sprint(v)
+	}
+	if f.c.EnableLogPrint(part, fromLogrusLevel(entry.Level)) != LogEnable {
+		return nil, nil
+	}
+	return f.formatter.Format(entry)
+}
+
+// fromLogrusLevel 返回 logrus.Level 对应的日志级别，PanicLevel 和 FatalLevel 都对应 fatal
+func fromLogrusLevel(level logrus.Level) int {
+	switch level {
+	case logrus.TraceLevel:
+		return LogTraceLevel
+	case logrus.DebugLevel:
+		return LogDebugLevel
+	case logrus.InfoLevel:
+		return LogInfoLevel
+	case logrus.WarnLevel:
+		return LogWarnLevel
+	case logrus.ErrorLevel:
+		return LogErrorLevel
+	default:
+		return LogFatalLevel
+	}
+}
@@ -0,0 +1,56 @@
+package dynamiclog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFromLogrusLevel(t *testing.T) {
+	for level, want := range map[logrus.Level]int{
+		logrus.TraceLevel: LogTraceLevel,
+		logrus.DebugLevel: LogDebugLevel,
+		logrus.InfoLevel:  LogInfoLevel,
+		logrus.WarnLevel:  LogWarnLevel,
+		logrus.ErrorLevel: LogErrorLevel,
+		logrus.FatalLevel: LogFatalLevel,
+		logrus.PanicLevel: LogFatalLevel,
+	} {
+		if got := fromLogrusLevel(level); got != want {
+			t.Errorf("fromLogrusLevel(%v) = %d, want %d", level, got, want)
+		}
+	}
+}
+
+func TestLogrusFormatterFiltersByPart(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl: warn\nctl.a: trace\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetLevel(logrus.TraceLevel)
+	logger.SetFormatter(NewLogrusFormatter(c, &logrus.TextFormatter{DisableTimestamp: true}))
+
+	ctl := logger.WithField(PartKey, "ctl")
+	ctl.Info("ctl info")
+	ctl.Warn("ctl warn")
+	logger.WithField(PartKey, "ctl.a").Trace("ctl.a trace")
+	logger.Info("default info")
+	logger.Debug("default debug")
+
+	out := buf.String()
+	for _, msg := range []string{"ctl warn", "ctl.a trace", "default info"} {
+		if !strings.Contains(out, `msg="`+msg+`"`) {
+			t.Errorf("%q is filtered: %s", msg, out)
+		}
+	}
+	for _, msg := range []string{"ctl info", "default debug"} {
+		if strings.Contains(out, `msg="`+msg+`"`) {
+			t.Errorf("%q is printed: %s", msg, out)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package dynamiclog
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+// Option 用于修改构造函数的默认行为
+type Option func(*options)
+
+type options struct {
+	defaultsIfMissing bool          // configmap 不存在时是否以默认级别启动
+	syncTimeout       time.Duration // 等待 informer 缓存同步的超时时间
+	registry          *LevelRegistry
+	klogVerbosity     map[string]klog.Level // 日志级别名称 -> klog V 级别，用于 KlogVerbose
+	backend           Backend               // PartLogger 输出日志的后端
+	layers            []ConfigMapLayer      // 优先级低于构造函数中的 configmap 的各层 configmap
+	pod               *PodInfo              // 当前 pod 的信息，为空时从环境变量读取
+	logger            logr.Logger           // 打印 dynamiclog 自身的运行信息，如同步失败、配置错误
+
+	suppressedReportInterval time.Duration // 打印被限速、采样的日志数的间隔
+}
+
+func newOptions(opts []Option) options {
+	o := options{syncTimeout: 30 * time.Second, suppressedReportInterval: time.Minute}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.registry == nil {
+		o.registry = NewLevelRegistry()
+	}
+	if o.klogVerbosity == nil {
+		o.klogVerbosity = DefaultKlogVerbosity
+	}
+	if o.backend == nil {
+		o.backend = klogBackend{}
+	}
+	if o.logger.GetSink() == nil {
+		o.logger = klog.Background().WithName("dynamic-log-set")
+	}
+	return o
+}
+
+// podInfo 返回 WithPodInfo 指定的 pod 信息，没有指定时从环境变量和 DefaultPodLabelsPath 读取
+func (o *options) podInfo() PodInfo {
+	if o.pod != nil {
+		return *o.pod
+	}
+	pod, err := PodInfoFromEnv(DefaultPodLabelsPath)
+	if err != nil {
+		o.logger.Error(err, "Read pod info failed, ignore pod labels")
+	}
+	return pod
+}
+
+// WithDefaultsIfMissing configmap 不存在时不返回 ErrConfigMapNotFound，
+// 而是所有 part 都使用默认日志级别启动，之后 configmap 被创建时自动生效
+func WithDefaultsIfMissing() Option {
+	return func(o *options) {
+		o.defaultsIfMissing = true
+	}
+}
+
+// WithSyncTimeout 设置等待 informer 缓存同步的超时时间，超时返回 ErrCacheSyncTimeout，默认 30s
+func WithSyncTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.syncTimeout = timeout
+	}
+}
+
+// WithLevelRegistry 使用自定义的日志级别（如团队自定义的级别、别名），默认为 NewLevelRegistry()
+func WithLevelRegistry(registry *LevelRegistry) Option {
+	return func(o *options) {
+		o.registry = registry.clone()
+	}
+}
+
+// WithKlogVerbosity 修改 KlogVerbose 使用的日志级别与 klog V 级别的映射，默认为 DefaultKlogVerbosity。
+// 例如 {"DEBUG": 6} 表示配置为 debug 的 part，KlogVerbose(part, v) 在 v <= 6 时打印；高于 info 的级别的映射不会生效，见 VerbosityEnabled
+func WithKlogVerbosity(verbosity map[string]klog.Level) Option {
+	return func(o *options) {
+		o.klogVerbosity = verbosity
+	}
+}
+
+// WithBackend 修改 PartLogger 输出日志的后端，默认使用 klog
+func WithBackend(backend Backend) Option {
+	return func(o *options) {
+		o.backend = backend
+	}
+}
+
+// WithSuppressedReportInterval 修改打印 "N messages suppressed for part" 的间隔，默认为 1 分钟
+func WithSuppressedReportInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.suppressedReportInterval = interval
+	}
+}
+
+// WithLayers 指定优先级低于构造函数中的 configmap 的其他 configmap，按优先级从低到高排列，合并规则见 ConfigMapLayer。
+// 多次调用时以最后一次为准。各层 configmap 不存在时的处理与构造函数中的 configmap 相同，见 WithDefaultsIfMissing
+func WithLayers(layers ...ConfigMapLayer) Option {
+	return func(o *options) {
+		o.layers = append([]ConfigMapLayer(nil), layers...)
+	}
+}
+
+// WithPodInfo 指定当前 pod 的信息，用于判断配置项的 when 条件，默认由 PodInfoFromEnv(DefaultPodLabelsPath) 读取
+func WithPodInfo(pod PodInfo) Option {
+	return func(o *options) {
+		o.pod = &pod
+	}
+}
+
+// WithLogger 修改打印 dynamiclog 自身运行信息（configmap 同步失败、配置错误、被限制的日志数等）的 logger，默认使用 klog。
+// 传入 logr.Discard() 时不打印，配置错误仍可通过 GetLogParseErrors 获取
+func WithLogger(logger logr.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
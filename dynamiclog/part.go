@@ -0,0 +1,162 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Backend 是 PartLogger 实际输出日志的后端，默认使用 klog，可通过 WithBackend 替换。
+// depth 为调用 Log 的位置之上还需跳过的栈帧数（用于打印调用方的文件和行号），
+// keysAndValues 的第一对总是 PartKey 和 part 名称；level 为 fatal 时后端应退出进程
+type Backend interface {
+	Log(depth int, level int, err error, msg string, keysAndValues ...interface{})
+}
+
+// PartLogger 是绑定了 part 的日志对象，每次打印前检查 part 当前的动态日志级别，
+// 通过 LogController.Part 获取
+type PartLogger struct {
+	c       *LogController
+	part    string
+	backend Backend
+}
+
+// Part 返回 partName 对应的 PartLogger，例如 logprint.Part("part1").Debugf("...")
+func (c *LogController) Part(partName string) *PartLogger {
+	return &PartLogger{c: c, part: partName, backend: c.opts.backend}
+}
+
+// Name 返回 PartLogger 对应的 part 名称
+func (p *PartLogger) Name() string {
+	return p.part
+}
+
+// Enabled 判断 part 当前是否打印 level 级别的日志
+func (p *PartLogger) Enabled(level int) bool {
+	return p.c.EnableLogPrint(p.part, level) == LogEnable
+}
+
+func (p *PartLogger) Tracef(format string, args ...interface{}) {
+	p.logf(LogTraceLevel, format, args...)
+}
+
+func (p *PartLogger) Debugf(format string, args ...interface{}) {
+	p.logf(LogDebugLevel, format, args...)
+}
+
+func (p *PartLogger) Infof(format string, args ...interface{}) {
+	p.logf(LogInfoLevel, format, args...)
+}
+
+func (p *PartLogger) Warnf(format string, args ...interface{}) {
+	p.logf(LogWarnLevel, format, args...)
+}
+
+func (p *PartLogger) Errorf(format string, args ...interface{}) {
+	p.logf(LogErrorLevel, format, args...)
+}
+
+// Fatalf 不受动态日志级别的限制，总是交给后端打印并退出进程
+func (p *PartLogger) Fatalf(format string, args ...interface{}) {
+	p.backend.Log(1, LogFatalLevel, nil, fmt.Sprintf(format, args...), PartKey, p.part)
+}
+
+// DebugS 打印结构化日志，keysAndValues 为交替的 key、value
+func (p *PartLogger) DebugS(msg string, keysAndValues ...interface{}) {
+	p.logS(LogDebugLevel, nil, msg, keysAndValues)
+}
+
+// InfoS 打印结构化日志，keysAndValues 为交替的 key、value
+func (p *PartLogger) InfoS(msg string, keysAndValues ...interface{}) {
+	p.logS(LogInfoLevel, nil, msg, keysAndValues)
+}
+
+// WarnS 打印结构化日志，keysAndValues 为交替的 key、value
+func (p *PartLogger) WarnS(msg string, keysAndValues ...interface{}) {
+	p.logS(LogWarnLevel, nil, msg, keysAndValues)
+}
+
+// ErrorS 打印结构化日志，err 可以为 nil
+func (p *PartLogger) ErrorS(err error, msg string, keysAndValues ...interface{}) {
+	p.logS(LogErrorLevel, err, msg, keysAndValues)
+}
+
+func (p *PartLogger) logf(level int, format string, args ...interface{}) {
+	p.log(logRecord{part: p.part, level: level, printf: true, msg: format, args: args})
+}
+
+func (p *PartLogger) logS(level int, err error, msg string, keysAndValues []interface{}) {
+	p.log(logRecord{part: p.part, level: level, err: err, msg: msg, args: keysAndValues})
+}
+
+// log 只在 part 打印 level 级别的日志时才格式化；不打印时交给 part 命中的配置项的 flight recorder 保存，
+// 打印 trigger 及以上级别的日志之前先输出 flight recorder 中的记录
+func (p *PartLogger) log(r logRecord) {
+	levels := p.c.cmInfo.load()
+	resolved := levels.resolve(p.part)
+	fr := levels.recorders[resolved.rule]
+	if !p.c.enabled(levels, p.part, resolved, r.level) {
+		if fr != nil && r.level < fr.spec.trigger {
+			r.at = time.Now()
+			fr.record(r)
+		}
+		return
+	}
+	// 跳过 log、logf 和调用 logf 的 Debugf 等方法
+	if fr != nil && r.level >= fr.spec.trigger {
+		for _, recorded := range fr.drain(time.Now()) {
+			p.emit(3, &recorded, "recordedAt", recorded.at.Format(time.RFC3339Nano))
+		}
+	}
+	p.emit(3, &r)
+}
+
+// emit 将 r 交给后端输出，depth 为调用 emit 的位置之上还需跳过的栈帧数
+func (p *PartLogger) emit(depth int, r *logRecord, keysAndValues ...interface{}) {
+	recordKVs := r.keysAndValues()
+	kvs := make([]interface{}, 0, 2+len(keysAndValues)+len(recordKVs))
+	kvs = append(append(append(kvs, PartKey, r.part), keysAndValues...), recordKVs...)
+	p.backend.Log(depth+1, r.level, r.err, r.message(), kvs...)
+}
+
+// klogBackend 是默认的 Backend：debug、info 使用 klog.InfoS，warn 使用 klog.Warning，error 使用 klog.ErrorS，fatal 使用 klog.Fatal
+type klogBackend struct{}
+
+func (klogBackend) Log(depth int, level int, err error, msg string, keysAndValues ...interface{}) {
+	switch {
+	case level >= LogFatalLevel:
+		klog.FatalDepth(depth+1, formatKV(err, msg, keysAndValues))
+	case level >= LogErrorLevel:
+		klog.ErrorSDepth(depth+1, err, msg, keysAndValues...)
+	case level >= LogWarnLevel:
+		klog.WarningDepth(depth+1, formatKV(err, msg, keysAndValues))
+	default:
+		if err != nil {
+			keysAndValues = append(keysAndValues, "err", err)
+		}
+		klog.InfoSDepth(depth+1, msg, keysAndValues...)
+	}
+}
+
+// formatKV 按 klog 结构化日志的格式将 msg 和 keysAndValues 拼接为一行，用于不支持结构化日志的 klog 函数
+func formatKV(err error, msg string, keysAndValues []interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q", msg)
+	if err != nil {
+		fmt.Fprintf(&b, " err=%q", err.Error())
+	}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var v interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		}
+		if s, ok := v.(string); ok {
+			fmt.Fprintf(&b, " %v=%q", keysAndValues[i], s)
+		} else {
+			fmt.Fprintf(&b, " %v=%+v", keysAndValues[i], v)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package dynamiclog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+func TestPartLoggerLevelGating(t *testing.T) {
+	c, backend := newBackendTestController(t, "part1: warn\npart2: off\n")
+	p := c.Part("part1")
+	p.Tracef("trace")
+	p.Debugf("debug")
+	p.Infof("info")
+	p.DebugS("debug")
+	p.InfoS("info")
+	p.Warnf("warn")
+	p.WarnS("warn")
+	p.Errorf("error")
+	p.ErrorS(nil, "error")
+	var got []string
+	for _, e := range backend.take() {
+		got = append(got, fmt.Sprintf("%d:%s", e.level, e.msg))
+	}
+	if want := []string{"3:warn", "3:warn", "4:error", "4:error"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("part1 printed %v, want %v", got, want)
+	}
+	if p.Enabled(LogInfoLevel) || !p.Enabled(LogWarnLevel) {
+		t.Error("Enabled does not follow the level of part1")
+	}
+
+	// off 不打印任何日志，Fatalf 除外
+	off := c.Part("part2")
+	off.Errorf("error")
+	off.Fatalf("fatal %d", 1)
+	entries := backend.take()
+	if len(entries) != 1 || entries[0].level != LogFatalLevel || entries[0].msg != "fatal 1" {
+		t.Errorf("part2 printed %+v, want only the fatal log", entries)
+	}
+}
+
+func TestPartLoggerKeysAndValues(t *testing.T) {
+	c, backend := newBackendTestController(t, "part1: debug\n")
+	p := c.Part("part1")
+	failed := errors.New("failed")
+	p.Infof("synced %d pods", 3)
+	p.InfoS("synced", "pods", 3, "node", "n1")
+	p.ErrorS(failed, "sync failed", "pods", 3)
+
+	entries := backend.take()
+	for _, tc := range []struct {
+		msg string
+		err error
+		kvs string
+	}{
+		// printf 格式化参数，结构化日志保留 key、value，PartKey 总是第一对
+		{"synced 3 pods", nil, "[part part1]"},
+		{"synced", nil, "[part part1 pods 3 node n1]"},
+		{"sync failed", failed, "[part part1 pods 3]"},
+	} {
+		if len(entries) == 0 {
+			t.Fatalf("missing log %q", tc.msg)
+		}
+		e := entries[0]
+		entries = entries[1:]
+		if e.msg != tc.msg || e.err != tc.err || fmt.Sprint(e.keysAndValues) != tc.kvs {
+			t.Errorf("logged %q err=%v %v, want %q err=%v %s", e.msg, e.err, e.keysAndValues, tc.msg, tc.err, tc.kvs)
+		}
+	}
+}
+
+// TestPartLoggerKlogCaller 默认的 klog 后端打印调用 Debugf 等方法的文件和行号
+func TestPartLoggerKlogCaller(t *testing.T) {
+	var buf bytes.Buffer
+	klog.LogToStderr(false)
+	klog.SetOutput(&buf)
+	defer func() {
+		klog.SetOutput(nil)
+		klog.LogToStderr(true)
+	}()
+
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "part1: debug record=10 trigger=error\npart2: warn record=10\n")); err != nil {
+		t.Fatal(err)
+	}
+	p := c.Part("part1")
+	callers := make(map[string]string)
+	p.Debugf("debug")
+	callers["debug"] = callerLine()
+	p.InfoS("info")
+	callers["info"] = callerLine()
+	p.WarnS("warn")
+	callers["warn"] = callerLine()
+	p.ErrorS(nil, "error")
+	callers["error"] = callerLine()
+	// flight recorder 中的记录使用触发输出的调用处
+	c.Part("part2").Debugf("recorded")
+	c.Part("part2").Errorf("trigger")
+	callers["recorded"] = callerLine()
+
+	klog.Flush()
+	out := buf.String()
+	for msg, caller := range callers {
+		found := false
+		for _, line := range strings.Split(out, "\n") {
+			if strings.Contains(line, `"`+msg+`"`) {
+				found = true
+				if !strings.Contains(line, " "+caller+"] ") {
+					t.Errorf("%q is logged at %s", line, caller)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%q is not logged: %s", msg, out)
+		}
+	}
+}
+
+// callerLine 返回调用处上一行的文件名和行号，与 klog 的格式相同
+func callerLine() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", file[strings.LastIndex(file, "/")+1:], line-1)
+}
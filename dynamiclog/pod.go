@@ -0,0 +1,172 @@
+package dynamiclog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// 同一个 Deployment 的所有副本读取同一个 configmap，可以用 when 让配置项只在部分 pod 中生效，
+// 由每个 pod 中的 LogController 根据自身的信息（见 PodInfoFromEnv）判断，不匹配的 pod 忽略该配置项：
+//
+//	part1: info
+//	part1: debug when pod=api-7c9f-xyz               # 只有 api-7c9f-xyz 使用 debug，其他 pod 使用上一行的 info
+//	part2: debug for=30m when node=node-3 labels=track=canary
+//
+// 文本格式中同一个 part 出现多次时，以最后一个匹配当前 pod 的为准；结构化格式中 part 的值写为列表，
+// 如 part1: [info, {level: debug, when: {pod: api-7c9f-xyz}}]，同样以最后一个匹配的为准。
+// pod、namespace、node 支持 * ? 通配，labels 为 label selector（如 app=api,track!=stable），多个条件同时满足时匹配。
+
+// pod 信息相关的环境变量，可以通过 downward API 设置：
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	- name: POD_NAMESPACE
+//	  valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	- name: NODE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+const (
+	PodNameEnv      = "POD_NAME"
+	PodNamespaceEnv = "POD_NAMESPACE"
+	NodeNameEnv     = "NODE_NAME"
+)
+
+// DefaultPodLabelsPath 是 downward API 挂载 pod labels 的默认路径：
+//
+//	volumes:
+//	- name: podinfo
+//	  downwardAPI:
+//	    items:
+//	    - path: labels
+//	      fieldRef: {fieldPath: metadata.labels}
+//
+// 挂载到 /etc/podinfo 时即为该路径
+const DefaultPodLabelsPath = "/etc/podinfo/labels"
+
+// PodInfo 是当前 pod 的信息，用于判断 when 中的条件，未知的字段不匹配任何条件
+type PodInfo struct {
+	Name      string
+	Namespace string
+	Node      string
+	Labels    map[string]string
+}
+
+// PodInfoFromEnv 从 POD_NAME、POD_NAMESPACE、NODE_NAME 环境变量和 downward API 挂载的 labels 文件读取当前 pod 的信息，
+// labels 文件不存在时 Labels 为空
+func PodInfoFromEnv(labelsPath string) (PodInfo, error) {
+	pod := PodInfo{
+		Name:      os.Getenv(PodNameEnv),
+		Namespace: os.Getenv(PodNamespaceEnv),
+		Node:      os.Getenv(NodeNameEnv),
+	}
+	data, err := os.ReadFile(labelsPath)
+	if os.IsNotExist(err) {
+		return pod, nil
+	} else if err != nil {
+		return pod, err
+	}
+
+	// downward API 的 labels 文件每行为 key="value"
+	pod.Labels = make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return pod, fmt.Errorf("parse pod labels %s: invalid line %q", labelsPath, line)
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		pod.Labels[key] = value
+	}
+	return pod, nil
+}
+
+// TargetConfig 是配置项的 when 条件，空字段不限制
+type TargetConfig struct {
+	Pod       string `json:"pod,omitempty"`       // pod 名称，支持 * ? 通配
+	Namespace string `json:"namespace,omitempty"` // pod 所在的 namespace，支持 * ? 通配
+	Node      string `json:"node,omitempty"`      // pod 所在的 node，支持 * ? 通配
+	Labels    string `json:"labels,omitempty"`    // pod label selector，如 app=api,track!=stable
+}
+
+// matches 判断 pod 是否满足 t 中的所有条件，t 为 nil 时总是满足。条件不合法时返回错误，与 pod 无关
+func (t *TargetConfig) matches(pod PodInfo) (bool, error) {
+	if t == nil {
+		return true, nil
+	}
+	matched := true
+	for _, cond := range []struct{ name, pattern, value string }{
+		{"pod", t.Pod, pod.Name},
+		{"namespace", t.Namespace, pod.Namespace},
+		{"node", t.Node, pod.Node},
+	} {
+		if cond.pattern == "" {
+			continue
+		}
+		ok, err := path.Match(cond.pattern, cond.value)
+		if err != nil {
+			return false, fmt.Errorf("%w %q", ErrInvalidTarget, cond.name+"="+cond.pattern)
+		}
+		matched = matched && ok && cond.value != ""
+	}
+	if t.Labels != "" {
+		selector, err := labels.Parse(t.Labels)
+		if err != nil {
+			return false, fmt.Errorf("%w %q: %v", ErrInvalidTarget, "labels="+t.Labels, err)
+		}
+		matched = matched && selector.Matches(labels.Set(pod.Labels))
+	}
+	return matched, nil
+}
+
+// forPod 返回 pc 以及文本格式中同一 part 之前的配置里，最后一个在 pod 中生效的配置，都不生效时 matched 为 false
+func (pc PartConfig) forPod(pod PodInfo) (PartConfig, bool, error) {
+	for p := &pc; p != nil; p = p.fallback {
+		matched, err := p.When.matches(pod)
+		if err != nil {
+			return *p, false, err
+		}
+		if matched {
+			return *p, true, nil
+		}
+	}
+	return pc, false, nil
+}
+
+// parseTarget 解析 "when" 之后的 "key=value ..." 条件
+func parseTarget(fields []string) (*TargetConfig, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("expect conditions after \"when\"")
+	}
+	target := &TargetConfig{}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		switch {
+		case !ok || value == "":
+			return nil, fmt.Errorf("expect \"key=value\" after \"when\", got %q", field)
+		case key == "pod":
+			target.Pod = value
+		case key == "namespace":
+			target.Namespace = value
+		case key == "node":
+			target.Node = value
+		case key == "labels":
+			target.Labels = value
+		default:
+			return nil, fmt.Errorf("unknown condition %q", key)
+		}
+	}
+	return target, nil
+}
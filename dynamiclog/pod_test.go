@@ -0,0 +1,46 @@
+package dynamiclog
+
+import (
+	"testing"
+)
+
+// TestStructuredPerPodFallback 结构化格式中 part 的值为列表时，与文本格式相同，以最后一个匹配当前 pod 的配置为准
+func TestStructuredPerPodFallback(t *testing.T) {
+	text := "part1: info\npart1: debug when pod=api-1\npart1: trace when labels=track=canary\n"
+	structured := `---
+parts:
+  part1:
+  - info
+  - {level: debug, when: {pod: api-1}}
+  - level: trace
+    when: {labels: track=canary}
+`
+	for _, tc := range []struct {
+		pod  PodInfo
+		want string
+	}{
+		{PodInfo{Name: "api-2"}, "info"},
+		{PodInfo{Name: "api-1"}, "debug"},
+		{PodInfo{Name: "api-1", Labels: map[string]string{"track": "canary"}}, "trace"},
+	} {
+		for _, data := range []string{text, structured} {
+			c := newTestController(WithPodInfo(tc.pod))
+			if err := c.parse(c.sources[0], newTestConfigMap("1", data)); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.GetLogPartLevelMap()["part1"]; got != tc.want {
+				t.Errorf("pod %+v: level of part1 = %q, want %q\n%s", tc.pod, got, tc.want, data)
+			}
+		}
+	}
+
+	for _, data := range []string{
+		"---\nparts:\n  part1: []\n",
+		"---\nparts:\n  part1: [info, [debug]]\n",
+		"---\nparts:\n  part1: [info, {when: {pod: api-1}}]\n",
+	} {
+		if _, err := ParseLogConfig(data); err == nil {
+			t.Errorf("ParseLogConfig(%q) should fail", data)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// recordingRateLimiter 记录 processNextItem 重新入队时的退避时间
+type recordingRateLimiter struct {
+	workqueue.RateLimiter
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (r *recordingRateLimiter) When(item interface{}) time.Duration {
+	d := r.RateLimiter.When(item)
+	r.mu.Lock()
+	r.delays = append(r.delays, d)
+	r.mu.Unlock()
+	return d
+}
+
+func (r *recordingRateLimiter) recorded() []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]time.Duration(nil), r.delays...)
+}
+
+// newQueueTestController 创建以 indexer 代替 informer 缓存的 LogController，并运行事件处理 goroutine
+func newQueueTestController(t *testing.T, limiter workqueue.RateLimiter) (*LogController, cache.Indexer) {
+	t.Helper()
+	c := newTestController()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	c.sources[0].lister = v1.NewConfigMapLister(indexer)
+	c.queue = workqueue.NewRateLimitingQueue(limiter)
+	c.spawn(c.runWithInformer)
+	t.Cleanup(c.Stop)
+	return c, indexer
+}
+
+// updateConfigMap 修改缓存中的 configmap 并像 informer 一样分发 add 或 update 事件
+func updateConfigMap(t *testing.T, c *LogController, indexer cache.Indexer, cm *corev1.ConfigMap) {
+	t.Helper()
+	old, _, _ := indexer.Get(cm)
+	if err := indexer.Update(cm); err != nil {
+		t.Fatal(err)
+	}
+	if old == nil {
+		c.add(cm)
+	} else {
+		c.update(old, cm)
+	}
+}
+
+// TestQueueCoalescesUpdates 连续的大量更新在队列中合并，最终状态与最后一个 revision 一致
+func TestQueueCoalescesUpdates(t *testing.T) {
+	c, indexer := newQueueTestController(t, workqueue.DefaultControllerRateLimiter())
+
+	const updates = 5000
+	levels := []string{"debug", "info", "warn", "error"}
+	for rev := 1; rev <= updates; rev++ {
+		data := fmt.Sprintf("part1: %s\npart%d: %s\n", levels[rev%4], rev%7+2, levels[(rev+1)%4])
+		updateConfigMap(t, c, indexer, newTestConfigMap(fmt.Sprint(rev), data))
+	}
+
+	// 最后一个 revision：part1 为 debug，part4 为 info
+	deadline := time.Now().Add(5 * time.Second)
+	for c.GetLogPartLevelDiff().NewRevision != fmt.Sprint(updates) {
+		if time.Now().After(deadline) {
+			t.Fatalf("revision = %q, want %d", c.GetLogPartLevelDiff().NewRevision, updates)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := c.GetLogPartLevelMap(); len(got) != 2 || got["part1"] != "debug" || got["part4"] != "info" {
+		t.Errorf("GetLogPartLevelMap() = %v, want part1: debug, part4: info", got)
+	}
+	if n := c.queue.Len(); n != 0 {
+		t.Errorf("queue length = %d, want 0", n)
+	}
+}
+
+// TestQueueRetriesParseFailureWithBackoff 解析失败时保留上一次的配置，并按退避策略重试直到 configmap 被修正
+func TestQueueRetriesParseFailureWithBackoff(t *testing.T) {
+	limiter := &recordingRateLimiter{RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(10*time.Millisecond, time.Second)}
+	c, indexer := newQueueTestController(t, limiter)
+
+	updateConfigMap(t, c, indexer, newTestConfigMap("1", "part1: debug"))
+	waitForLevel(t, c, "part1", "debug")
+
+	// 无法解析的配置，之后不再有新的事件，只能依靠重试
+	updateConfigMap(t, c, indexer, newTestConfigMap("2", "part1 warn"))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(limiter.recorded()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("retried %d times, want at least 3", len(limiter.recorded()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := c.GetLogPartLevelMap()["part1"]; got != "debug" {
+		t.Errorf("level of part1 = %q after parse failure, want debug", got)
+	}
+	if errs := c.GetLogParseErrors(); len(errs) != 1 || errs[0].Revision != "2" {
+		t.Errorf("GetLogParseErrors() = %v, want the error of revision 2", errs)
+	}
+	delays := limiter.recorded()
+	for i := 1; i < len(delays); i++ {
+		if delays[i] < delays[i-1] {
+			t.Errorf("retry delays %v decrease", delays)
+			break
+		}
+	}
+
+	// 修正 configmap 时不分发事件，由下一次重试读取最新的配置
+	if err := indexer.Update(newTestConfigMap("3", "part1: warn")); err != nil {
+		t.Fatal(err)
+	}
+	waitForLevel(t, c, "part1", "warn")
+	if errs := c.GetLogParseErrors(); len(errs) != 0 {
+		t.Errorf("GetLogParseErrors() = %v after the configmap is fixed", errs)
+	}
+	// 成功后不再退避（Forget）
+	deadline = time.Now().Add(5 * time.Second)
+	for c.queue.NumRequeues(c.sources[0].key()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("requeues of the configmap are not reset after a successful sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+package dynamiclog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConfigMapVerbs 是 dynamiclog 读取日志配置 configmap 所需的权限，只需要 configmap 所在 namespace 的 Role：
+//
+//	apiVersion: rbac.authorization.k8s.io/v1
+//	kind: Role
+//	metadata:
+//	  namespace: <cmNamespace>
+//	  name: dynamic-log-reader
+//	rules:
+//	- apiGroups: [""]
+//	  resources: ["configmaps"]
+//	  resourceNames: ["<cmName>"]
+//	  verbs: ["get", "list", "watch"]
+//
+// dynamiclog 的 list/watch 都带有 metadata.name field selector，因此可以用 resourceNames 限制到这一个 configmap。
+var ConfigMapVerbs = []string{"get", "list", "watch"}
+
+// CheckAccess 通过 SelfSubjectAccessReview 检查当前身份是否可以读取 namespace 下名称为 name 的 configmap，
+// 缺少权限时返回包装了 ErrForbidden 的错误，错误信息中会列出缺少的 verb
+func CheckAccess(ctx context.Context, clientset kubernetes.Interface, namespace, name string) error {
+	var denied []string
+	for _, verb := range ConfigMapVerbs {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      verb,
+					Resource:  "configmaps",
+					Name:      name,
+				},
+			},
+		}
+		result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("check access to configmap %s/%s: %w", namespace, name, err)
+		}
+		if !result.Status.Allowed {
+			denied = append(denied, verb)
+		}
+	}
+	if len(denied) != 0 {
+		return fmt.Errorf("%w: cannot %s %s/%s, need a Role granting %v on configmaps in namespace %s",
+			ErrForbidden, strings.Join(denied, "/"), namespace, name, ConfigMapVerbs, namespace)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 出现 error 时，之前被过滤掉的 debug 日志往往最有用。可以为配置项开启 flight recorder，
+// 在内存中保留 PartLogger 中未打印的日志，打印 trigger 及以上级别的日志之前先输出这些记录：
+//
+//	part1: info record=200                  # 保留最近 200 条，打印 error 及以上的日志时输出
+//	part2: info record=30s trigger=warn     # 保留最近 30 秒（最多 maxRecords 条），打印 warn 及以上的日志时输出
+//
+// 记录时只保存 format 和参数，输出时才格式化。selector 或上级配置（如 ctl.*）的 flight recorder 由匹配的所有 part 共享，
+// 其中任意一个 part 打印 trigger 及以上的日志时输出所有记录，每条记录仍然标记为记录它的 part。
+
+// maxRecords 是按时长保留记录时的最大条数
+const maxRecords = 1000
+
+// recorderSpec 是配置项的 flight recorder 设置，设置不变时复用 flightRecorder 以保留记录
+type recorderSpec struct {
+	size    int           // 最多保留的条数，0 表示不开启
+	window  time.Duration // 只输出该时长内的记录，0 表示不限制
+	trigger int           // 打印该级别及以上的日志时输出记录
+}
+
+func (s recorderSpec) enabled() bool {
+	return s.size > 0
+}
+
+// logRecord 是 PartLogger 中的一条日志
+type logRecord struct {
+	part   string // 记录这条日志的 part，共享 flight recorder 时与输出记录的 part 不同
+	at     time.Time
+	level  int
+	err    error
+	printf bool          // 为 true 时 msg 为 format，args 为其参数
+	msg    string        // 结构化日志的消息
+	args   []interface{} // printf 的参数或结构化日志的 keysAndValues
+}
+
+// message 返回日志消息，printf 形式的日志此时才格式化
+func (r *logRecord) message() string {
+	if r.printf {
+		return fmt.Sprintf(r.msg, r.args...)
+	}
+	return r.msg
+}
+
+// keysAndValues 返回结构化日志的 keysAndValues
+func (r *logRecord) keysAndValues() []interface{} {
+	if r.printf {
+		return nil
+	}
+	return r.args
+}
+
+// flightRecorder 是固定大小的环形缓冲区，可以并发调用
+type flightRecorder struct {
+	spec    recorderSpec
+	mu      sync.Mutex
+	records []logRecord
+	next    int // 下一条记录写入的位置，缓冲区满后覆盖最早的记录
+}
+
+func newFlightRecorder(spec recorderSpec) *flightRecorder {
+	return &flightRecorder{spec: spec, records: make([]logRecord, 0, spec.size)}
+}
+
+// record 保存一条未打印的日志
+func (fr *flightRecorder) record(r logRecord) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if len(fr.records) < fr.spec.size {
+		fr.records = append(fr.records, r)
+		return
+	}
+	fr.records[fr.next] = r
+	fr.next = (fr.next + 1) % fr.spec.size
+}
+
+// drain 按时间顺序返回 window 内的记录并清空缓冲区
+func (fr *flightRecorder) drain(now time.Time) []logRecord {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	records := make([]logRecord, 0, len(fr.records))
+	for i := range fr.records {
+		r := fr.records[(fr.next+i)%len(fr.records)]
+		if fr.spec.window == 0 || now.Sub(r.at) <= fr.spec.window {
+			records = append(records, r)
+		}
+	}
+	fr.records, fr.next = fr.records[:0], 0
+	return records
+}
+
+// recorder 返回 part 的 flightRecorder，设置与 rl 中的相同时复用，保留记录
+func (rl *revisionedLevels) recorder(part string, spec recorderSpec) *flightRecorder {
+	if fr, ok := rl.recorders[part]; ok && fr.spec == spec {
+		return fr
+	}
+	return newFlightRecorder(spec)
+}
+
+// recorderSpec 返回 record=、trigger= 指定的设置
+func (cmi *ConfigMapInfo) recorderSpec(pc PartConfig) (recorderSpec, error) {
+	if pc.Record == "" {
+		if pc.Trigger != "" {
+			return recorderSpec{}, fmt.Errorf("%w: trigger without record", ErrInvalidRecorder)
+		}
+		return recorderSpec{}, nil
+	}
+
+	spec := recorderSpec{trigger: LogErrorLevel}
+	if n, err := strconv.Atoi(pc.Record); err == nil && n > 0 {
+		spec.size = n
+	} else if d, err := time.ParseDuration(pc.Record); err == nil && d > 0 {
+		spec.size, spec.window = maxRecords, d
+	} else {
+		return recorderSpec{}, fmt.Errorf("%w %q", ErrInvalidRecorder, "record="+pc.Record)
+	}
+	if spec.size > maxRecords {
+		spec.size = maxRecords
+	}
+	if pc.Trigger != "" {
+		trigger, ok := cmi.registry.Parse(pc.Trigger)
+		if !ok {
+			return recorderSpec{}, fmt.Errorf("%w %q", ErrInvalidRecorder, "trigger="+pc.Trigger)
+		}
+		spec.trigger = trigger
+	}
+	return spec, nil
+}
@@ -0,0 +1,135 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// backendEntry 是 recordingBackend 收到的一条日志
+type backendEntry struct {
+	depth         int
+	level         int
+	err           error
+	msg           string
+	keysAndValues []interface{}
+}
+
+// value 返回 key 对应的值
+func (e backendEntry) value(key string) (interface{}, bool) {
+	for i := 0; i+1 < len(e.keysAndValues); i += 2 {
+		if e.keysAndValues[i] == key {
+			return e.keysAndValues[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// recordingBackend 记录 PartLogger 交给后端的日志
+type recordingBackend struct {
+	mu      sync.Mutex
+	entries []backendEntry
+}
+
+func (b *recordingBackend) Log(depth int, level int, err error, msg string, keysAndValues ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, backendEntry{depth: depth, level: level, err: err, msg: msg, keysAndValues: keysAndValues})
+}
+
+// take 返回并清空收到的日志
+func (b *recordingBackend) take() []backendEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := b.entries
+	b.entries = nil
+	return entries
+}
+
+// newBackendTestController 创建使用 recordingBackend 的 LogController，并加载 data 中的配置
+func newBackendTestController(t *testing.T, data string) (*LogController, *recordingBackend) {
+	t.Helper()
+	backend := &recordingBackend{}
+	c := newTestController(WithBackend(backend))
+	if err := c.parse(c.sources[0], newTestConfigMap("1", data)); err != nil {
+		t.Fatal(err)
+	}
+	return c, backend
+}
+
+// checkEntries 检查日志的消息、part 以及是否来自 flight recorder
+func checkEntries(t *testing.T, got []backendEntry, want ...[3]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries %+v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		part, _ := got[i].value(PartKey)
+		_, recorded := got[i].value("recordedAt")
+		if got[i].msg != w[0] || part != w[1] || fmt.Sprint(recorded) != w[2] {
+			t.Errorf("entry %d = %q part=%v recorded=%v, want %q part=%s recorded=%s", i, got[i].msg, part, recorded, w[0], w[1], w[2])
+		}
+	}
+}
+
+func TestFlightRecorderRingWrap(t *testing.T) {
+	c, backend := newBackendTestController(t, "part1: info record=3\n")
+	p := c.Part("part1")
+	for i := 0; i < 5; i++ {
+		p.Debugf("debug %d", i)
+	}
+	if entries := backend.take(); len(entries) != 0 {
+		t.Fatalf("debug logs printed: %+v", entries)
+	}
+	p.Errorf("failed")
+	// 只保留最近的 3 条，按时间顺序输出在 error 之前
+	checkEntries(t, backend.take(),
+		[3]string{"debug 2", "part1", "true"},
+		[3]string{"debug 3", "part1", "true"},
+		[3]string{"debug 4", "part1", "true"},
+		[3]string{"failed", "part1", "false"},
+	)
+	// 输出后缓冲区被清空
+	p.Errorf("failed again")
+	checkEntries(t, backend.take(), [3]string{"failed again", "part1", "false"})
+}
+
+func TestFlightRecorderWindow(t *testing.T) {
+	fr := newFlightRecorder(recorderSpec{size: maxRecords, window: time.Minute})
+	now := time.Now()
+	fr.record(logRecord{at: now.Add(-2 * time.Minute), msg: "old"})
+	fr.record(logRecord{at: now.Add(-30 * time.Second), msg: "recent"})
+	records := fr.drain(now)
+	if len(records) != 1 || records[0].msg != "recent" {
+		t.Errorf("drain() = %+v, want only the record within the window", records)
+	}
+	if records := fr.drain(now); len(records) != 0 {
+		t.Errorf("drain() after drain = %+v, want empty", records)
+	}
+}
+
+func TestFlightRecorderTrigger(t *testing.T) {
+	c, backend := newBackendTestController(t, "part1: info record=10 trigger=warn\n")
+	p := c.Part("part1")
+	p.Debugf("debug")
+	p.InfoS("info") // 打印，但低于 trigger，不输出记录
+	checkEntries(t, backend.take(), [3]string{"info", "part1", "false"})
+
+	p.WarnS("warn", "k", "v")
+	checkEntries(t, backend.take(),
+		[3]string{"debug", "part1", "true"},
+		[3]string{"warn", "part1", "false"},
+	)
+}
+
+// TestFlightRecorderSharedBySelector selector 的 flight recorder 由匹配的 part 共享，记录保留各自的 part
+func TestFlightRecorderSharedBySelector(t *testing.T) {
+	c, backend := newBackendTestController(t, "ctl.*: info record=10\n")
+	c.Part("ctl.a").Debugf("debug of a")
+	c.Part("ctl.b").Errorf("error of b")
+	checkEntries(t, backend.take(),
+		[3]string{"debug of a", "ctl.a", "true"},
+		[3]string{"error of b", "ctl.b", "false"},
+	)
+}
@@ -0,0 +1,121 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configmap 中的 part 名称除了普通名称，还可以是 selector：
+//
+//	*.cache: debug                 # glob，* 匹配任意字符（包括分隔符），? 匹配单个字符
+//	re:^(pod|node)-sync$: warn     # 正则，以 re: 开头
+//
+// 没有精确配置、也没有上级配置的 part 依次匹配最长的 glob（按非通配字符数）、
+// 按配置顺序第一个匹配的正则，都不匹配时使用默认级别。
+
+// regexPrefix 是正则 selector 的前缀
+const regexPrefix = "re:"
+
+// selectors 保存一个 revision 中的 glob 和正则 selector
+type selectors struct {
+	compiled map[string]*regexp.Regexp // 解析过程中编译好的正则
+	globs    []globRule                // 按非通配字符数从多到少排序
+	regexps  []regexRule               // 按配置顺序
+}
+
+type globRule struct {
+	pattern string
+	literal int // 非通配字符数，越多越具体
+}
+
+type regexRule struct {
+	rule string // configmap 中的写法，包括 re: 前缀
+	re   *regexp.Regexp
+}
+
+// isSelector 判断 part 名称是否是 glob 或正则 selector
+func isSelector(name string) bool {
+	return strings.HasPrefix(name, regexPrefix) || strings.ContainsAny(name, "*?")
+}
+
+// compile 检查 selector 是否合法，正则不合法时返回错误
+func (s *selectors) compile(rule string) error {
+	if !strings.HasPrefix(rule, regexPrefix) {
+		return nil
+	}
+	re, err := regexp.Compile(strings.TrimPrefix(rule, regexPrefix))
+	if err != nil {
+		return fmt.Errorf("invalid regexp: %w", err)
+	}
+	if s.compiled == nil {
+		s.compiled = make(map[string]*regexp.Regexp)
+	}
+	s.compiled[rule] = re
+	return nil
+}
+
+// build 根据最终生效的配置项（partList）生成 selector 列表，只包含日志级别合法的配置项。
+// glob 按具体程度排序，相同时按字典序，保证结果稳定
+func (s *selectors) build(partList []string) {
+	for _, rule := range partList {
+		if !isSelector(rule) {
+			continue
+		}
+		if re, ok := s.compiled[rule]; ok {
+			s.regexps = append(s.regexps, regexRule{rule: rule, re: re})
+			continue
+		}
+		literal := len(rule) - strings.Count(rule, "*") - strings.Count(rule, "?")
+		s.globs = append(s.globs, globRule{pattern: rule, literal: literal})
+	}
+	s.compiled = nil
+	sort.SliceStable(s.globs, func(i, j int) bool {
+		if s.globs[i].literal != s.globs[j].literal {
+			return s.globs[i].literal > s.globs[j].literal
+		}
+		return s.globs[i].pattern < s.globs[j].pattern
+	})
+}
+
+// match 返回 partName 命中的 selector
+func (s *selectors) match(partName string) (string, bool) {
+	for _, g := range s.globs {
+		if globMatch(g.pattern, partName) {
+			return g.pattern, true
+		}
+	}
+	for _, r := range s.regexps {
+		if r.re.MatchString(partName) {
+			return r.rule, true
+		}
+	}
+	return "", false
+}
+
+// globMatch 判断 name 是否匹配 pattern，* 匹配任意字符（包括分隔符），? 匹配单个字符
+func globMatch(pattern, name string) bool {
+	p, n := 0, 0
+	star, mark := -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, n
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			n = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
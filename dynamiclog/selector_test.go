@@ -0,0 +1,90 @@
+package dynamiclog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// checkRules 检查 part 生效的日志级别和 GetLogPartEffectiveLevels 中命中的配置项
+func checkRules(t *testing.T, c *LogController, want map[string][2]string) {
+	t.Helper()
+	for part := range want {
+		c.EnableLogPrint(part, LogInfoLevel)
+	}
+	effective := c.GetLogPartEffectiveLevels()
+	for part, w := range want {
+		if got := effective[part]; got.Level != w[0] || got.Rule != w[1] {
+			t.Errorf("%s: level %q rule %q, want level %q rule %q", part, got.Level, got.Rule, w[0], w[1])
+		}
+	}
+}
+
+func TestSelectorPrecedence(t *testing.T) {
+	c := newTestController()
+	data := "ctl: warn\nctl.*: error\n*.cache: debug\n*cache: fatal\nre:^z: trace\nre:cache$: off\n"
+	if err := c.parse(c.sources[0], newTestConfigMap("1", data)); err != nil {
+		t.Fatal(err)
+	}
+	checkRules(t, c, map[string][2]string{
+		"ctl":        {"warn", "ctl"},
+		"ctl.a":      {"error", "ctl.*"},   // "parent.*" 优先于 "parent"
+		"ctl.cache":  {"error", "ctl.*"},   // 上级优先于 glob
+		"node.cache": {"debug", "*.cache"}, // 最长的 glob
+		"nodecache":  {"fatal", "*cache"},  // glob 优先于正则
+		"zone":       {"trace", "re:^z"},
+		"other":      {"info", ""},
+	})
+}
+
+// TestRegexConfigOrder 多个正则都匹配时以配置中靠前的为准，文本、YAML、JSON 格式相同
+func TestRegexConfigOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name, data, rule string
+	}{
+		{"text", "re:^zz: error\nre:^z: trace\n", "re:^zz"},
+		{"text reversed", "re:^z: trace\nre:^zz: error\n", "re:^z"},
+		{"yaml", "---\nparts:\n  re:^zz: error\n  re:^z: trace\n", "re:^zz"},
+		{"yaml reversed", "---\nparts:\n  re:^z: trace\n  re:^zz: error\n", "re:^z"},
+		{"json", `{"parts": {"re:^zz": "error", "re:^z": "trace"}}`, "re:^zz"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestController()
+			if err := c.parse(c.sources[0], newTestConfigMap("1", tc.data)); err != nil {
+				t.Fatal(err)
+			}
+			c.EnableLogPrint("zzz", LogInfoLevel)
+			if got := c.GetLogPartEffectiveLevels()["zzz"].Rule; got != tc.rule {
+				t.Errorf("rule of zzz = %q, want %q", got, tc.rule)
+			}
+		})
+	}
+}
+
+func TestInvalidRegexRejected(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "re:^(pod: debug\npart1: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+	errs := c.GetLogParseErrors()
+	if len(errs) != 1 || errs[0].PartName != "re:^(pod" || errs[0].Revision != "1" {
+		t.Fatalf("GetLogParseErrors() = %v, want the error of re:^(pod", errs)
+	}
+	if _, ok := c.GetLogPartLevelMap()["re:^(pod"]; ok {
+		t.Error("invalid regexp is kept in the level map")
+	}
+	checkRules(t, c, map[string][2]string{
+		"pod":   {"info", ""},
+		"part1": {"warn", "part1"},
+	})
+
+	if err := c.Override("re:^(", "debug", 0); err != nil {
+		t.Errorf("removing a missing override returns %v", err)
+	}
+	if err := c.Override("re:^(", "debug", time.Minute); err == nil {
+		t.Error("Override accepts an invalid regexp")
+	}
+	if errors.Is(errs[0], ErrUnknownLevel) {
+		t.Errorf("invalid regexp is reported as %v", errs[0])
+	}
+}
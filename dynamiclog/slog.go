@@ -0,0 +1,65 @@
+//go:build go1.21
+
+package dynamiclog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogHandler 包装任意 slog.Handler，按 configmap 中 part 的动态日志级别过滤日志
+type slogHandler struct {
+	c    LogInterface
+	h    slog.Handler
+	part string
+}
+
+// NewSlogHandler 返回包装 h 的 slog.Handler：part 来自 logger 的 PartKey 属性（logger.With(slog.String("part", "cache"))），
+// 之后的 WithGroup 以 “.” 连接为下级 part；Enabled 按 part 配置的日志级别判断，日志被过滤时没有内存分配。
+// 过滤由 dynamiclog 完成，不调用 h.Enabled，h 自身配置的级别不再生效。
+// 需要 Go 1.21 及以上的工具链（log/slog）：go.mod 仍为 go 1.19，更低版本的工具链编译时不包含 NewSlogHandler、SlogLevel 和 FromSlogLevel
+func NewSlogHandler(c LogInterface, h slog.Handler) slog.Handler {
+	return &slogHandler{c: c, h: h}
+}
+
+func (s *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return s.c.EnableLogPrint(s.part, FromSlogLevel(level)) == LogEnable
+}
+
+func (s *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	return s.h.Handle(ctx, r)
+}
+
+func (s *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	part := s.part
+	for _, a := range attrs {
+		if a.Key == PartKey {
+			part = a.Value.Resolve().String()
+		}
+	}
+	return &slogHandler{c: s.c, h: s.h.WithAttrs(attrs), part: part}
+}
+
+func (s *slogHandler) WithGroup(name string) slog.Handler {
+	part := name
+	if s.part != "" {
+		part = s.part + "." + name
+	}
+	return &slogHandler{c: s.c, h: s.h.WithGroup(name), part: part}
+}
+
+// SlogLevel 返回日志级别对应的 slog.Level：trace、debug、info、warn、error、fatal
+// 分别对应 LevelDebug-4、LevelDebug、LevelInfo、LevelWarn、LevelError、LevelError+4，其余数值按与 info 的差值换算
+func SlogLevel(level int) slog.Level {
+	return slog.LevelInfo + slog.Level(level-LogInfoLevel)*4
+}
+
+// FromSlogLevel 返回 slog.Level 对应的日志级别，是 SlogLevel 的逆映射，两个 slog 级别之间的值向下取整（如 LevelInfo+2 为 info）
+func FromSlogLevel(level slog.Level) int {
+	diff := int(level - slog.LevelInfo)
+	if diff < 0 {
+		// 向下取整
+		return LogInfoLevel - (-diff+3)/4
+	}
+	return LogInfoLevel + diff/4
+}
@@ -0,0 +1,96 @@
+//go:build go1.21
+
+package dynamiclog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLevel(t *testing.T) {
+	for _, tc := range []struct {
+		level int
+		slog  slog.Level
+	}{
+		{LogTraceLevel, slog.LevelDebug - 4},
+		{LogDebugLevel, slog.LevelDebug},
+		{LogInfoLevel, slog.LevelInfo},
+		{LogWarnLevel, slog.LevelWarn},
+		{LogErrorLevel, slog.LevelError},
+		{LogFatalLevel, slog.LevelError + 4},
+	} {
+		if got := SlogLevel(tc.level); got != tc.slog {
+			t.Errorf("SlogLevel(%d) = %v, want %v", tc.level, got, tc.slog)
+		}
+		if got := FromSlogLevel(tc.slog); got != tc.level {
+			t.Errorf("FromSlogLevel(%v) = %d, want %d", tc.slog, got, tc.level)
+		}
+	}
+	// 两个级别之间向下取整
+	for _, tc := range []struct {
+		slog  slog.Level
+		level int
+	}{
+		{slog.LevelInfo + 2, LogInfoLevel},
+		{slog.LevelInfo + 3, LogInfoLevel},
+		{slog.LevelInfo - 1, LogDebugLevel},
+		{slog.LevelDebug - 1, LogTraceLevel},
+		{slog.LevelError + 8, LogOffLevel},
+	} {
+		if got := FromSlogLevel(tc.slog); got != tc.level {
+			t.Errorf("FromSlogLevel(%v) = %d, want %d", tc.slog, got, tc.level)
+		}
+	}
+}
+
+func TestSlogHandlerFiltersByPart(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl: warn\nctl.a: debug\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	// h 自身的级别不起过滤作用
+	logger := slog.New(NewSlogHandler(c, slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelError})))
+	ctl := logger.With(slog.String(PartKey, "ctl"))
+	ctl.Info("ctl info")
+	ctl.Warn("ctl warn")
+	ctl.WithGroup("a").Debug("ctl.a debug")
+	ctl.WithGroup("b").Info("ctl.b info")
+	logger.Info("default info")
+	logger.Debug("default debug")
+
+	out := buf.String()
+	for _, msg := range []string{"ctl warn", "ctl.a debug", "default info"} {
+		if !strings.Contains(out, "msg=\""+msg+"\"") {
+			t.Errorf("%q is filtered: %s", msg, out)
+		}
+	}
+	for _, msg := range []string{"ctl info", "ctl.b info", "default debug"} {
+		if strings.Contains(out, "msg=\""+msg+"\"") {
+			t.Errorf("%q is printed: %s", msg, out)
+		}
+	}
+}
+
+func TestSlogHandlerFilteredNoAlloc(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := slog.New(NewSlogHandler(c, slog.NewTextHandler(&buf, nil))).With(slog.String(PartKey, "ctl"))
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Debug("filtered")
+		logger.LogAttrs(ctx, slog.LevelInfo, "filtered", slog.Int("pods", 3))
+	})
+	if allocs != 0 {
+		t.Errorf("filtered logs allocate %v times", allocs)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("filtered logs are printed: %s", buf.String())
+	}
+}
@@ -0,0 +1,138 @@
+package dynamiclog
+
+import (
+	"sort"
+	"time"
+)
+
+// revisionedLevels 是某个 revision 的 ConfigMap 日志配置解析结果。
+// 创建后不再修改，解析出新 revision 时通过 atomic.Value 整体替换，
+// 因此 EnableLogPrint 等热路径上的读取无需加锁。
+type revisionedLevels struct {
+	rev          string                     // ConfigMap revision，多层配置时为最近一次发生变化的一层的 resourceVersion
+	layer        string                     // rev 所在的 configmap（namespace/name），见 mergeLayers
+	layerRevs    map[string]string          // 各层 configmap（namespace/name）-> resourceVersion，见 mergeLayers
+	partLevelMap map[string]string          // partName -> configmap 中配置的日志级别
+	partLevels   map[string]int             // partName -> 日志级别对应的数值，解析时计算好，避免每次调用 strings.ToUpper
+	partList     []string                   // configmap 中出现的 partName，按首次出现的顺序去重
+	defaultLevel string                     // 未配置的 part 使用的日志级别，configmap 中没有配置时为构造函数传入的默认级别
+	defaultNum   int                        // defaultLevel 对应的数值
+	defaultLayer string                     // 配置了 defaultLevel 的 configmap（namespace/name），为空表示使用构造函数传入的默认级别
+	layers       map[string]string          // partName -> 所在的 configmap（namespace/name），见 mergeLayers
+	diff         LogLevelDiff               // 与上一个 revision 相比的变化
+	errs         []*LogParseError           // 解析该 revision 时日志级别不合法的 part
+	selectors    selectors                  // part 名称为 glob 或正则的配置项
+	resolved     resolveCache               // 没有精确配置的 part 的解析结果缓存
+	expires      map[string]time.Time       // 设置了过期时间的配置项（until=、for= 或 Override）
+	durations    map[string]string          // 设置了 for= 的配置项在 configmap 中的值，值不变时沿用之前的过期时间
+	overridden   map[string]struct{}        // 由 Override 设置的配置项
+	rules        []contextRule              // 请求级别的日志级别规则
+	limits       map[string]*ruleLimiter    // 设置了限速或采样的配置项
+	recorders    map[string]*flightRecorder // 设置了 flight recorder 的配置项
+}
+
+// LogLevelDiff 描述相邻两个 revision 之间 part 的变化，各列表均按 partName 排序。
+// Removed 中的 part 之后会使用默认日志级别（或继承、selector 匹配到的级别）。
+// Changed 还包括没有精确配置、但继承或 selector 匹配到的日志级别发生变化的 part。
+type LogLevelDiff struct {
+	Layer           string // 发生变化的 configmap（namespace/name），OldRevision、NewRevision 都是它的 resourceVersion
+	OldRevision     string
+	NewRevision     string
+	Added           []string // 新增的 part
+	Changed         []string // 日志级别发生变化的 part
+	Removed         []string // 被删除的 part
+	OldDefaultLevel string   // 变化前未配置的 part 使用的日志级别
+	NewDefaultLevel string   // 变化后未配置的 part 使用的日志级别
+}
+
+// Empty 表示两个 revision 之间没有 part 或默认级别发生变化
+func (d LogLevelDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0 && d.OldDefaultLevel == d.NewDefaultLevel
+}
+
+// newRevisionedLevels 创建空快照，configmap 尚未加载或被删除时所有 part 都使用默认级别
+func newRevisionedLevels(defaultLevel string, defaultNum int) *revisionedLevels {
+	return &revisionedLevels{
+		partLevelMap: make(map[string]string),
+		partLevels:   make(map[string]int),
+		expires:      make(map[string]time.Time),
+		durations:    make(map[string]string),
+		overridden:   make(map[string]struct{}),
+		limits:       make(map[string]*ruleLimiter),
+		recorders:    make(map[string]*flightRecorder),
+		layers:       make(map[string]string),
+		defaultLevel: defaultLevel,
+		defaultNum:   defaultNum,
+	}
+}
+
+// level 返回 partName 的日志级别数值（包括从上级继承的），未配置时返回默认级别，ok 为 false
+func (rl *revisionedLevels) level(partName string) (int, bool) {
+	r := rl.resolve(partName)
+	return r.level, r.rule != ""
+}
+
+// set 记录 partName 的日志级别，同一个 part 出现多次时以最后一次为准，partList 中只保留一份
+func (rl *revisionedLevels) set(partName, level string, levelNum int) {
+	if _, ok := rl.partLevelMap[partName]; !ok {
+		rl.partList = append(rl.partList, partName)
+	}
+	rl.partLevelMap[partName] = level
+	rl.partLevels[partName] = levelNum
+}
+
+// diffFrom 计算 prev 到 rl 的变化并记录在 rl 中，只能在 rl 发布前调用
+func (rl *revisionedLevels) diffFrom(prev *revisionedLevels) {
+	rl.diff = LogLevelDiff{
+		Layer:           rl.layer,
+		OldRevision:     prev.layerRevs[rl.layer],
+		NewRevision:     rl.rev,
+		OldDefaultLevel: prev.defaultLevel,
+		NewDefaultLevel: rl.defaultLevel,
+	}
+	for part, level := range rl.partLevelMap {
+		if oldLevel, ok := prev.partLevelMap[part]; !ok {
+			rl.diff.Added = append(rl.diff.Added, part)
+		} else if oldLevel != level {
+			rl.diff.Changed = append(rl.diff.Changed, part)
+		}
+	}
+	for part := range prev.partLevelMap {
+		if _, ok := rl.partLevelMap[part]; !ok {
+			rl.diff.Removed = append(rl.diff.Removed, part)
+		}
+	}
+	// 上一个快照中用到的、没有精确配置而通过继承或 selector 得到日志级别的 part，只解析不写入新快照的缓存
+	prev.resolved.each(func(part string, old resolvedLevel) {
+		if _, ok := rl.partLevelMap[part]; ok {
+			return
+		}
+		if r := rl.lookup(part); old.name != r.name {
+			rl.diff.Changed = append(rl.diff.Changed, part)
+		}
+	})
+	sort.Strings(rl.diff.Added)
+	sort.Strings(rl.diff.Changed)
+	sort.Strings(rl.diff.Removed)
+}
+
+// effectiveLevel 返回命中 rule 的 part 的 EffectiveLevel，包括 rule 的过期时间和所在的 configmap
+func (rl *revisionedLevels) effectiveLevel(level, rule string) EffectiveLevel {
+	if rule == "" {
+		return EffectiveLevel{Level: level, Layer: rl.defaultLayer}
+	}
+	if _, overridden := rl.overridden[rule]; overridden {
+		return EffectiveLevel{Level: level, Rule: rule, Until: rl.expires[rule], Override: true}
+	}
+	return EffectiveLevel{Level: level, Rule: rule, Until: rl.expires[rule], Layer: rl.layers[rule]}
+}
+
+// copyPartState 复制 part 在 from 中的限速、采样和 flight recorder，保留其中的计数和记录
+func (rl *revisionedLevels) copyPartState(from *revisionedLevels, part string) {
+	if l, ok := from.limits[part]; ok {
+		rl.limits[part] = l
+	}
+	if r, ok := from.recorders[part]; ok {
+		rl.recorders[part] = r
+	}
+}
@@ -0,0 +1,95 @@
+package dynamiclog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newTestController 创建未启动的 LogController，configmap 通过 parse 直接交给它
+func newTestController(opts ...Option) *LogController {
+	return newLogController(context.Background(), "default", "log-set", "log", "info", opts)
+}
+
+func newTestConfigMap(rev, data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "log-set", ResourceVersion: rev},
+		Data:       map[string]string{"log": data},
+	}
+}
+
+// TestSnapshotConcurrentReadsDuringParse 在大量 goroutine 判断日志级别的同时不断解析新的 revision，
+// 需要配合 go test -race 运行
+func TestSnapshotConcurrentReadsDuringParse(t *testing.T) {
+	c := newTestController()
+	s := c.sources[0]
+	if err := c.parse(s, newTestConfigMap("1", "part1: debug\npart2: warn\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	const readers = 200
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			part := fmt.Sprintf("part%d", i%4)
+			for !stop.Load() {
+				enabled := c.EnableLogPrint(part, LogInfoLevel)
+				if enabled != LogEnable && enabled != LogDisable {
+					t.Errorf("EnableLogPrint(%q) = %d", part, enabled)
+					return
+				}
+				c.KlogEnableLogPrint(part, LogWarnLevel)
+				runtime.Gosched()
+			}
+		}(i)
+	}
+
+	levels := []string{"debug", "info", "warn", "error"}
+	for rev := 2; rev <= 500; rev++ {
+		if rev%100 == 0 {
+			// configmap 被删除后重新创建
+			c.reset(s, fmt.Sprint(rev))
+		}
+		data := fmt.Sprintf("part1: %s\npart2: %s\n", levels[rev%4], levels[(rev+1)%4])
+		if rev%3 == 0 {
+			data += fmt.Sprintf("part3: %s\n", levels[(rev+2)%4])
+		}
+		if err := c.parse(s, newTestConfigMap(fmt.Sprint(rev)+"-cm", data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	// 最后一个 revision：part1 为 debug，part2 为 info，part3 未配置，使用默认的 info
+	for _, tc := range []struct {
+		part  string
+		level int
+		want  int
+	}{
+		{"part1", LogDebugLevel, LogEnable},
+		{"part2", LogDebugLevel, LogDisable},
+		{"part2", LogInfoLevel, LogEnable},
+		{"part3", LogDebugLevel, LogDisable},
+		{"part3", LogInfoLevel, LogEnable},
+	} {
+		if got := c.EnableLogPrint(tc.part, tc.level); got != tc.want {
+			t.Errorf("EnableLogPrint(%q, %d) = %d, want %d", tc.part, tc.level, got, tc.want)
+		}
+	}
+	if got := c.GetLogPartNameList(); len(got) != 2 || got[0] != "part1" || got[1] != "part2" {
+		t.Errorf("GetLogPartNameList() = %v", got)
+	}
+	if rev := c.GetLogPartLevelDiff().NewRevision; rev != "500-cm" {
+		t.Errorf("revision = %q, want 500-cm", rev)
+	}
+}
@@ -0,0 +1,175 @@
+package dynamiclog
+
+import (
+	"context"
+	"sync"
+)
+
+// LevelChangeEvent 描述某个 part 在一次 configmap 变化中的日志级别变化，
+// PartName 为空表示未配置的 part 使用的默认日志级别发生了变化
+type LevelChangeEvent struct {
+	PartName        string
+	OldLevel        string // 变化前的日志级别，新增的 part 为变化前继承或默认的日志级别
+	NewLevel        string // 变化后的日志级别，被删除的 part 为变化后继承或默认的日志级别
+	ResourceVersion string // 触发变化的 ConfigMap resourceVersion
+	Layer           string // 触发变化的 ConfigMap（namespace/name），见 WithLayers
+}
+
+// levelChangeHandlers 保存 OnLevelChange 注册的回调，按注册顺序调用，以及发布快照时产生、尚未通知的事件
+type levelChangeHandlers struct {
+	mu        sync.Mutex
+	handlers  []*levelChangeHandler
+	pending   []LevelChangeEvent // 按快照发布的顺序排列
+	notifying bool               // 有 goroutine 正在调用回调
+}
+
+type levelChangeHandler struct {
+	fn func(LevelChangeEvent)
+}
+
+// add 注册回调，返回取消注册的函数
+func (h *levelChangeHandlers) add(fn func(LevelChangeEvent)) func() {
+	handler := &levelChangeHandler{fn: fn}
+	h.mu.Lock()
+	h.handlers = append(h.handlers, handler)
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for i, hd := range h.handlers {
+			if hd == handler {
+				h.handlers = append(h.handlers[:i:i], h.handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// snapshot 返回当前注册的回调，调用回调时不持有锁，回调中可以再次注册或取消注册
+func (h *levelChangeHandlers) snapshot() []*levelChangeHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*levelChangeHandler(nil), h.handlers...)
+}
+
+// enqueue 记录待通知的事件，调用方需持有 applyMu，保证事件的顺序与快照发布的顺序一致
+func (h *levelChangeHandlers) enqueue(events []LevelChangeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending = append(h.pending, events...)
+}
+
+// isNotifying 返回是否有 goroutine 正在调用回调
+func (h *levelChangeHandlers) isNotifying() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.notifying
+}
+
+// OnLevelChange 注册日志级别变化的回调，每次解析出新的 configmap revision 后，
+// 对每个新增、修改、删除的 part 调用一次 fn。
+// fn 在发布快照的 goroutine（configmap 事件处理 goroutine、Override 的调用方或过期定时器）释放内部锁之后调用，
+// 同一时刻只有一个 goroutine 按发布顺序调用回调，fn 中可以调用 Override 和 Stop，但不应长时间阻塞。返回值用于取消注册。
+func (c *LogController) OnLevelChange(fn func(LevelChangeEvent)) func() {
+	return c.handlers.add(fn)
+}
+
+// WatchLevelChange 返回接收日志级别变化事件的 channel，ctx 结束或 Stop 后 channel 会被关闭。
+// 未读取的事件缓存在每个 channel 自己的队列中，读取慢不会阻塞 configmap 变化的处理和其他订阅者。
+func (c *LogController) WatchLevelChange(ctx context.Context) <-chan LevelChangeEvent {
+	var mu sync.Mutex
+	var queue []LevelChangeEvent
+	wake := make(chan struct{}, 1)
+	ch := make(chan LevelChangeEvent, 16)
+
+	cancel := c.OnLevelChange(func(ev LevelChangeEvent) {
+		mu.Lock()
+		queue = append(queue, ev)
+		mu.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+	forward := func() {
+		defer close(ch)
+		defer cancel()
+		for {
+			mu.Lock()
+			events := queue
+			queue = nil
+			mu.Unlock()
+			for _, ev := range events {
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				case <-c.ctx.Done():
+					return
+				}
+			}
+			if len(events) > 0 {
+				continue
+			}
+			select {
+			case <-wake:
+			case <-ctx.Done():
+				return
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}
+	if !c.spawn(forward) {
+		cancel()
+		close(ch)
+	}
+	return ch
+}
+
+// enqueueEvents 根据 prev 到 cur 的变化生成事件，等释放 applyMu 之后由 notify 通知订阅者，调用方需持有 applyMu
+func (c *LogController) enqueueEvents(prev, cur *revisionedLevels) {
+	if cur.diff.Empty() {
+		return
+	}
+	if len(c.handlers.snapshot()) == 0 {
+		return
+	}
+
+	events := make([]LevelChangeEvent, 0, len(cur.diff.Added)+len(cur.diff.Changed)+len(cur.diff.Removed)+1)
+	if cur.diff.OldDefaultLevel != cur.diff.NewDefaultLevel {
+		events = append(events, LevelChangeEvent{OldLevel: prev.defaultLevel, NewLevel: cur.defaultLevel, ResourceVersion: cur.rev, Layer: cur.layer})
+	}
+	for _, parts := range [][]string{cur.diff.Added, cur.diff.Changed, cur.diff.Removed} {
+		for _, part := range parts {
+			events = append(events, LevelChangeEvent{PartName: part, OldLevel: prev.lookup(part).name, NewLevel: cur.lookup(part).name, ResourceVersion: cur.rev, Layer: cur.layer})
+		}
+	}
+	c.handlers.enqueue(events)
+}
+
+// notify 在释放 applyMu 之后调用，把待通知的事件依次交给订阅者。
+// 已有 goroutine 在通知时直接返回，由它继续通知新的事件，因此回调中调用 Override 不会重入，事件的顺序也不变
+func (c *LogController) notify() {
+	h := &c.handlers
+	h.mu.Lock()
+	if h.notifying {
+		h.mu.Unlock()
+		return
+	}
+	h.notifying = true
+	for len(h.pending) > 0 {
+		events := h.pending
+		h.pending = nil
+		h.mu.Unlock()
+		for _, handler := range h.snapshot() {
+			for _, ev := range events {
+				handler.fn(ev)
+			}
+		}
+		h.mu.Lock()
+	}
+	h.notifying = false
+	h.mu.Unlock()
+}
@@ -0,0 +1,90 @@
+package dynamiclog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// within 在 d 内等待 fn 返回，超时说明发生了死锁或阻塞
+func within(t *testing.T, d time.Duration, what string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("%s blocked", what)
+	}
+}
+
+// TestOverrideInLevelChangeCallback 回调中调用 Override 不会死锁，产生的事件在当前事件之后通知
+func TestOverrideInLevelChangeCallback(t *testing.T) {
+	c := newTestController()
+	var events []LevelChangeEvent
+	c.OnLevelChange(func(ev LevelChangeEvent) {
+		events = append(events, ev)
+		if ev.PartName == "part1" && ev.NewLevel == "debug" {
+			if err := c.Override("part2", "error", time.Minute); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	within(t, 5*time.Second, "Override in OnLevelChange", func() {
+		if err := c.parse(c.sources[0], newTestConfigMap("1", "part1: debug\n")); err != nil {
+			t.Error(err)
+		}
+	})
+	if len(events) != 2 || events[0].PartName != "part1" || events[1].PartName != "part2" || events[1].NewLevel != "error" {
+		t.Errorf("events = %+v, want part1 then part2", events)
+	}
+}
+
+// TestStopInLevelChangeCallback 在 configmap 事件处理 goroutine 调用的回调中调用 Stop 不会死锁
+func TestStopInLevelChangeCallback(t *testing.T) {
+	c, indexer := newQueueTestController(t, workqueue.DefaultControllerRateLimiter())
+	stopped := make(chan struct{})
+	c.OnLevelChange(func(LevelChangeEvent) {
+		within(t, 5*time.Second, "Stop in OnLevelChange", c.Stop)
+		close(stopped)
+	})
+	updateConfigMap(t, c, indexer, newTestConfigMap("1", "part1: debug"))
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnLevelChange is not called")
+	}
+	within(t, 5*time.Second, "Stop", c.Stop)
+}
+
+// TestSlowWatcherDoesNotBlock 不读取 WatchLevelChange 的 channel 时 Override 和 configmap 的处理不被阻塞，事件也不丢失
+func TestSlowWatcherDoesNotBlock(t *testing.T) {
+	c := newTestController()
+	t.Cleanup(c.Stop)
+	ch := c.WatchLevelChange(context.Background())
+
+	const changes = 100
+	levels := []string{"debug", "info"}
+	within(t, 5*time.Second, "Override with a slow watcher", func() {
+		for i := 0; i < changes; i++ {
+			if err := c.Override("part1", levels[i%2], time.Minute); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	for i := 0; i < changes; i++ {
+		select {
+		case ev := <-ch:
+			if ev.PartName != "part1" || ev.NewLevel != levels[i%2] {
+				t.Fatalf("event %d = %+v, want part1: %s", i, ev, levels[i%2])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d events, want %d", i, changes)
+		}
+	}
+}
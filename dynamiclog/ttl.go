@@ -0,0 +1,202 @@
+package dynamiclog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// part 的日志级别可以设置过期时间，过期后自动恢复为没有该配置时的级别（继承、selector 或默认级别），无需再次修改 configmap：
+//
+//	part1: debug until=2026-10-18T12:00:00Z    # 到指定时间（RFC3339）过期
+//	part2: debug for=30m                       # 从这一行最后一次修改的时间开始，30 分钟后过期
+//
+// 也可以调用 Override 临时修改某个 part 的日志级别，过期后恢复为 configmap 中的配置。
+
+// levelOverride 是 Override 设置的日志级别
+type levelOverride struct {
+	level    string
+	levelNum int
+	until    time.Time
+}
+
+// Override 临时将 partName 的日志级别设置为 level，ttl 之后恢复为 configmap 中的配置，期间 configmap 的更新不会覆盖它。
+// ttl <= 0 时删除 partName 的 Override。Override 会触发 OnLevelChange，也可以在 OnLevelChange 的回调中调用
+func (c *LogController) Override(partName, level string, ttl time.Duration) error {
+	defer c.notify()
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+	if ttl <= 0 {
+		if _, ok := c.overrides[partName]; !ok {
+			return nil
+		}
+		delete(c.overrides, partName)
+		c.apply()
+		return nil
+	}
+
+	levelNum, ok := c.cmInfo.registry.Parse(level)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownLevel, level)
+	}
+	if isSelector(partName) {
+		var s selectors
+		if err := s.compile(partName); err != nil {
+			return err
+		}
+	}
+	c.overrides[partName] = levelOverride{level: level, levelNum: levelNum, until: time.Now().Add(ttl)}
+	c.apply()
+	return nil
+}
+
+// setBase 记录从 s 解析出的配置，与其他层合并后发布
+func (c *LogController) setBase(s *configMapSource, base *revisionedLevels) {
+	defer c.notify()
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+	s.base, s.parseErr = base, nil
+	c.storeParseErrs()
+	c.changed = s
+	c.apply()
+}
+
+// setParseError 记录 s 整个配置无法解析时的错误，s 保留上一次解析出的配置
+func (c *LogController) setParseError(s *configMapSource, err *LogParseError) {
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+	s.parseErr = err
+	c.storeParseErrs()
+}
+
+// expire 在最近的过期时间到达时重新发布快照
+func (c *LogController) expire() {
+	defer c.notify()
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.apply()
+}
+
+// apply 根据各层 configmap 的配置和 overrides 生成当前生效的快照并发布，再为最近的过期时间设置定时器，调用方需持有 applyMu
+func (c *LogController) apply() {
+	now := time.Now()
+	for part, o := range c.overrides {
+		if !now.Before(o.until) {
+			delete(c.overrides, part)
+		}
+	}
+	rl, next := c.effectiveLevels(now)
+	c.publish(rl)
+
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+		c.expiryTimer = nil
+	}
+	if !next.IsZero() && c.ctx.Err() == nil {
+		c.expiryTimer = time.AfterFunc(next.Sub(now), c.expire)
+	}
+}
+
+// effectiveLevels 合并各层 configmap 中未过期的配置项、加上 Override，返回新的快照和其中最近的过期时间。
+// 被 Override 的配置项保留在原来的位置，保证正则 selector 的匹配顺序不变
+func (c *LogController) effectiveLevels(now time.Time) (*revisionedLevels, time.Time) {
+	base := c.mergeLayers(now)
+	rl := newRevisionedLevels(base.defaultLevel, base.defaultNum)
+	rl.rev, rl.errs, rl.rules = base.rev, base.errs, base.rules
+	rl.layer, rl.layerRevs = base.layer, base.layerRevs
+	rl.defaultLayer, rl.layers = base.defaultLayer, base.layers
+	var next time.Time
+	add := func(part, level string, levelNum int, until time.Time, from *revisionedLevels) {
+		if !until.IsZero() && !now.Before(until) {
+			return
+		}
+		// selector 在解析 configmap 或调用 Override 时已经检查过
+		_ = rl.selectors.compile(part)
+		rl.set(part, level, levelNum)
+		if from != nil {
+			rl.copyPartState(from, part)
+		}
+		if until.IsZero() {
+			return
+		}
+		rl.expires[part] = until
+		if next.IsZero() || until.Before(next) {
+			next = until
+		}
+	}
+
+	for _, part := range base.partList {
+		if o, ok := c.overrides[part]; ok {
+			add(part, o.level, o.levelNum, o.until, nil)
+			rl.overridden[part] = struct{}{}
+			continue
+		}
+		add(part, base.partLevelMap[part], base.partLevels[part], base.expires[part], base)
+	}
+	parts := make([]string, 0, len(c.overrides))
+	for part := range c.overrides {
+		if _, ok := base.partLevelMap[part]; !ok {
+			parts = append(parts, part)
+		}
+	}
+	sort.Strings(parts)
+	for _, part := range parts {
+		o := c.overrides[part]
+		add(part, o.level, o.levelNum, o.until, nil)
+		rl.overridden[part] = struct{}{}
+	}
+	rl.selectors.build(rl.partList)
+	return rl, next
+}
+
+// expiry 返回 until= 或 for= 指定的过期时间，没有设置时返回零值。
+// for= 从 since 开始计算，但 part 的值与上一个 revision 相同时沿用 prev 中的过期时间，修改其他 part 不会重新计时
+func (pc PartConfig) expiry(since time.Time, prev *revisionedLevels, part string) (time.Time, error) {
+	switch {
+	case pc.Until != "" && pc.For != "":
+		return time.Time{}, fmt.Errorf("%w: until and for are mutually exclusive", ErrInvalidTTL)
+	case pc.Until != "":
+		until, err := time.Parse(time.RFC3339, pc.Until)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w %q", ErrInvalidTTL, "until="+pc.Until)
+		}
+		return until, nil
+	case pc.For != "":
+		d, err := time.ParseDuration(pc.For)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("%w %q", ErrInvalidTTL, "for="+pc.For)
+		}
+		if until, ok := prev.expires[part]; ok && prev.durations[part] == pc.value() {
+			return until, nil
+		}
+		return since.Add(d), nil
+	}
+	return time.Time{}, nil
+}
+
+// value 返回 pc 的规范化表示，用于判断 part 的值是否发生变化
+func (pc PartConfig) value() string {
+	data, _ := json.Marshal(pc)
+	return string(data)
+}
+
+// modifiedTime 返回 configmap 最后一次修改的时间，用于计算值发生变化的 part 的 for=。
+// 优先使用 managedFields 中最新的时间，没有时使用当前时间（即首次解析该 revision 的时间）
+func modifiedTime(cm *corev1.ConfigMap) time.Time {
+	var t time.Time
+	for _, f := range cm.ManagedFields {
+		if f.Time != nil && f.Time.After(t) {
+			t = f.Time.Time
+		}
+	}
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,45 @@
+package dynamiclog
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newModifiedConfigMap 创建 managedFields 中最后修改时间为 modified 的 configmap
+func newModifiedConfigMap(rev, data string, modified time.Time) *corev1.ConfigMap {
+	cm := newTestConfigMap(rev, data)
+	cm.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl", Time: &metav1.Time{Time: modified}}}
+	return cm
+}
+
+// TestForKeepsCountdownWhenOtherPartsChange for= 只在该 part 的值变化时重新计时
+func TestForKeepsCountdownWhenOtherPartsChange(t *testing.T) {
+	c := newTestController()
+	s := c.sources[0]
+	t1 := time.Now().Truncate(time.Second)
+
+	for _, tc := range []struct {
+		name     string
+		data     string
+		modified time.Time
+		want     time.Time
+	}{
+		{"first revision", "part1: debug for=30m\npart2: info\n", t1, t1.Add(30 * time.Minute)},
+		{"other part changed", "part1: debug for=30m\npart2: warn\n", t1.Add(10 * time.Minute), t1.Add(30 * time.Minute)},
+		{"duration changed", "part1: debug for=1h\npart2: warn\n", t1.Add(20 * time.Minute), t1.Add(80 * time.Minute)},
+		{"level changed", "part1: trace for=1h\npart2: warn\n", t1.Add(25 * time.Minute), t1.Add(85 * time.Minute)},
+		{"invalid level keeps the last value", "part1: verbose for=1h\npart2: warn\n", t1.Add(26 * time.Minute), t1.Add(85 * time.Minute)},
+		{"restored", "part1: trace for=1h\npart2: error\n", t1.Add(27 * time.Minute), t1.Add(85 * time.Minute)},
+	} {
+		rev := tc.modified.Format(time.RFC3339)
+		if err := c.parse(s, newModifiedConfigMap(rev, tc.data, tc.modified)); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := c.GetLogPartEffectiveLevels()["part1"].Until; !got.Equal(tc.want) {
+			t.Errorf("%s: part1 expires at %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
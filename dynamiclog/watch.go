@@ -0,0 +1,160 @@
+package dynamiclog
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// errWatchExpired 表示 watch 的 resourceVersion 已过期，需要重新 list
+var errWatchExpired = fmt.Errorf("watch resource version expired")
+
+// newWatchBackoff 返回 clientset 模式下 list/watch 出错时的退避策略
+func newWatchBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    10,
+		Cap:      time.Minute,
+	}
+}
+
+// fieldSelector 只选择名称为 s.name 的 configmap
+func (s *configMapSource) fieldSelector() string {
+	return fields.OneTermEqualSelector("metadata.name", s.name).String()
+}
+
+// list 获取 s 的 configmap 当前状态，并记录之后 watch 的起始 resourceVersion，返回 configmap 是否存在
+func (c *LogController) list(s *configMapSource) (bool, error) {
+	cms, err := s.client.List(c.ctx, metav1.ListOptions{FieldSelector: s.fieldSelector()})
+	if err != nil {
+		return false, err
+	}
+
+	var found *corev1.ConfigMap
+	for i := range cms.Items {
+		if cms.Items[i].Name == s.name {
+			found = &cms.Items[i]
+			break
+		}
+	}
+	if found == nil {
+		// configmap 不存在（或在断开期间被删除），所有 part 使用默认级别
+		if s.base.rev != "" || len(s.base.partList) != 0 {
+			c.reset(s, "")
+		}
+	} else if found.ResourceVersion != s.base.rev {
+		if err := c.parse(s, found); err != nil {
+			c.opts.logger.Error(err, "Keep the last valid log level")
+		}
+	}
+	s.watchRev = cms.ResourceVersion
+	return found != nil, nil
+}
+
+// runWithClientset use clientset to watch the changes of ConfigMap and handle it in time.
+func (c *LogController) runWithClientset(s *configMapSource) {
+	backoff := newWatchBackoff()
+	needList := false
+	for {
+		var err error
+		if needList {
+			if _, err = c.list(s); err == nil {
+				needList = false
+			}
+		}
+		if err == nil {
+			err = c.watch(s)
+		}
+
+		switch {
+		case c.ctx.Err() != nil:
+			return
+		case err == nil:
+			// watch 正常结束（如服务端超时），从最近的 resourceVersion 继续
+			backoff = newWatchBackoff()
+			continue
+		case err == errWatchExpired:
+			c.opts.logger.Info("Watch configmap expired, relisting", "configmap", s.key())
+			needList = true
+			continue
+		}
+
+		c.opts.logger.Error(err, "Watch configmap failed", "configmap", s.key())
+		select {
+		case <-time.After(backoff.Step()):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// watch 从 s.watchRev 开始 watch s 的 configmap，直到 watch 结束或出错
+func (c *LogController) watch(s *configMapSource) error {
+	w, err := s.client.Watch(c.ctx, metav1.ListOptions{
+		FieldSelector:       s.fieldSelector(),
+		ResourceVersion:     s.watchRev,
+		AllowWatchBookmarks: true,
+	})
+	if err != nil {
+		if apierrors.IsGone(err) || apierrors.IsResourceExpired(err) {
+			return errWatchExpired
+		}
+		return err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if err := c.handleWatchEvent(s, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleWatchEvent 处理 s 的一个 watch 事件并推进 s.watchRev
+func (c *LogController) handleWatchEvent(s *configMapSource, event watch.Event) error {
+	switch event.Type {
+	case watch.Error:
+		err := apierrors.FromObject(event.Object)
+		if apierrors.IsGone(err) || apierrors.IsResourceExpired(err) {
+			return errWatchExpired
+		}
+		return err
+	case watch.Bookmark:
+		if obj, err := meta.Accessor(event.Object); err == nil {
+			s.watchRev = obj.GetResourceVersion()
+		}
+		return nil
+	}
+
+	cm, ok := event.Object.(*corev1.ConfigMap)
+	if !ok || cm.Name != s.name {
+		return nil
+	}
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		if err := c.parse(s, cm); err != nil {
+			c.opts.logger.Error(err, "Keep the last valid log level")
+		}
+	case watch.Deleted:
+		c.reset(s, cm.ResourceVersion)
+	}
+	s.watchRev = cm.ResourceVersion
+	return nil
+}
@@ -0,0 +1,194 @@
+package dynamiclog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// watchHarness 通过 fake clientset 的 reactor 控制 list 的结果和每一次 watch
+type watchHarness struct {
+	mu        sync.Mutex
+	cm        *corev1.ConfigMap // list 返回的 configmap，nil 表示不存在
+	listRev   string            // list 返回的 resourceVersion
+	listErrs  int               // 之后的 list 请求中需要失败的次数
+	listTimes []time.Time       // 每次 list 请求的时间
+	watches   chan watchCall
+}
+
+type watchCall struct {
+	rev     string // watch 请求的 resourceVersion
+	watcher *watch.FakeWatcher
+}
+
+// newWatchHarness 以 cm 为初始状态启动 clientset 模式的 LogController
+func newWatchHarness(t *testing.T, cm *corev1.ConfigMap) (*watchHarness, LogInterface) {
+	t.Helper()
+	h := &watchHarness{cm: cm, listRev: cm.ResourceVersion, watches: make(chan watchCall, 10)}
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("list", "configmaps", h.list)
+	cs.PrependWatchReactor("configmaps", h.watch)
+
+	l, err := NewWithClientset(context.Background(), cs, "default", "log-set", "log", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Stop)
+	return h, l
+}
+
+func (h *watchHarness) list(k8stesting.Action) (bool, runtime.Object, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listTimes = append(h.listTimes, time.Now())
+	if h.listErrs > 0 {
+		h.listErrs--
+		return true, nil, apierrors.NewServiceUnavailable("apiserver is restarting")
+	}
+	list := &corev1.ConfigMapList{ListMeta: metav1.ListMeta{ResourceVersion: h.listRev}}
+	if h.cm != nil {
+		list.Items = append(list.Items, *h.cm)
+	}
+	return true, list, nil
+}
+
+func (h *watchHarness) watch(action k8stesting.Action) (bool, watch.Interface, error) {
+	w := watch.NewFakeWithChanSize(10, false)
+	h.watches <- watchCall{rev: action.(k8stesting.WatchActionImpl).WatchRestrictions.ResourceVersion, watcher: w}
+	return true, w, nil
+}
+
+// set 修改之后 list 返回的结果
+func (h *watchHarness) set(cm *corev1.ConfigMap, listRev string, listErrs int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cm, h.listRev, h.listErrs = cm, listRev, listErrs
+}
+
+func (h *watchHarness) lists() []time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]time.Time(nil), h.listTimes...)
+}
+
+// nextWatch 等待 LogController 发起下一次 watch，并检查其 resourceVersion
+func (h *watchHarness) nextWatch(t *testing.T, rev string) *watch.FakeWatcher {
+	t.Helper()
+	select {
+	case call := <-h.watches:
+		if call.rev != rev {
+			t.Fatalf("watch from resourceVersion %q, want %q", call.rev, rev)
+		}
+		return call.watcher
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for watch from resourceVersion %q", rev)
+	}
+	return nil
+}
+
+// waitForLevel 等待 part 的日志级别变为 level，level 为空表示 part 不在 configmap 中
+func waitForLevel(t *testing.T, l LogInterface, part, level string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, ok := l.GetLogPartLevelMap()[part]
+		if (level == "" && !ok) || (level != "" && got == level) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("level of %q = %q, want %q", part, got, level)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientsetResumesFromLastResourceVersion(t *testing.T) {
+	h, l := newWatchHarness(t, newTestConfigMap("10", "part1: debug"))
+	w := h.nextWatch(t, "10")
+
+	w.Modify(newTestConfigMap("11", "part1: warn"))
+	waitForLevel(t, l, "part1", "warn")
+	w.Action(watch.Bookmark, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "12"}})
+
+	// watch 正常结束后从最近的 resourceVersion 继续，不重新 list
+	w.Stop()
+	h.nextWatch(t, "12")
+	if n := len(h.lists()); n != 1 {
+		t.Errorf("listed %d times, want 1", n)
+	}
+}
+
+func TestClientsetRelistsOnGone(t *testing.T) {
+	h, l := newWatchHarness(t, newTestConfigMap("10", "part1: debug"))
+	w := h.nextWatch(t, "10")
+
+	// 断开期间 configmap 被修改，watch 的 resourceVersion 已经过期
+	h.set(newTestConfigMap("20", "part1: error"), "21", 0)
+	w.Error(&apierrors.NewGone("too old resource version: 10").ErrStatus)
+
+	h.nextWatch(t, "21")
+	waitForLevel(t, l, "part1", "error")
+	if n := len(h.lists()); n != 2 {
+		t.Errorf("listed %d times, want 2", n)
+	}
+}
+
+func TestClientsetConfigMapDeletedAndRecreated(t *testing.T) {
+	h, l := newWatchHarness(t, newTestConfigMap("10", "part1: debug"))
+	w := h.nextWatch(t, "10")
+
+	w.Delete(newTestConfigMap("11", "part1: debug"))
+	waitForLevel(t, l, "part1", "")
+	if got := l.EnableLogPrint("part1", LogDebugLevel); got != LogDisable {
+		t.Errorf("part1 should use the default level after the configmap is deleted")
+	}
+
+	w.Add(newTestConfigMap("12", "part1: warn"))
+	waitForLevel(t, l, "part1", "warn")
+	if rev := l.GetLogPartLevelDiff().NewRevision; rev != "12" {
+		t.Errorf("revision = %q, want 12", rev)
+	}
+}
+
+func TestClientsetBacksOffOnListErrors(t *testing.T) {
+	h, l := newWatchHarness(t, newTestConfigMap("10", "part1: debug"))
+	w := h.nextWatch(t, "10")
+
+	// 重新 list 时前两次失败，按 newWatchBackoff 退避后重试
+	h.set(newTestConfigMap("20", "part1: error"), "20", 2)
+	w.Error(&apierrors.NewGone("too old resource version: 10").ErrStatus)
+
+	h.nextWatch(t, "20")
+	waitForLevel(t, l, "part1", "error")
+	times := h.lists()
+	if len(times) != 4 {
+		t.Fatalf("listed %d times, want 4", len(times))
+	}
+	// Jitter 只会增加等待时间，因此两次重试至少间隔 Duration、Duration*Factor
+	backoff := newWatchBackoff()
+	min := backoff.Duration
+	for i := 1; i <= 2; i++ {
+		if gap := times[i+1].Sub(times[i]); gap < min {
+			t.Errorf("retry %d after %v, want at least %v", i, gap, min)
+		}
+		min = time.Duration(float64(min) * backoff.Factor)
+	}
+}
+
+func TestClientsetConfigMapNotFound(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	_, err := NewWithClientset(context.Background(), cs, "default", "log-set", "log", "info")
+	if !errors.Is(err, ErrConfigMapNotFound) {
+		t.Fatalf("err = %v, want ErrConfigMapNotFound", err)
+	}
+}
@@ -0,0 +1,75 @@
+package dynamiclog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// zapCore 包装任意 zapcore.Core，按 logger 名称对应 part 的动态日志级别过滤日志
+type zapCore struct {
+	c    LogInterface
+	core zapcore.Core
+}
+
+// NewZapCore 返回包装 core 的 zapcore.Core：logger 名称即 part（logger.Named("part")，多次 Named 以 “.” 连接，对应分层的 part），
+// 按 part 配置的日志级别过滤日志（与 zap 级别的互相转换见 ZapLevel、FromZapLevel）。
+// 过滤由 dynamiclog 完成，core 应配置为打印所有级别的日志（如 ZapLevel(LogTraceLevel)）。
+// 用法：logger := zap.New(dynamiclog.NewZapCore(logprint, core)).Named("part1")
+func NewZapCore(c LogInterface, core zapcore.Core) zapcore.Core {
+	return &zapCore{c: c, core: core}
+}
+
+// Enabled 没有 logger 名称，无法判断 part，交给 Check 按 part 过滤
+func (z *zapCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (z *zapCore) With(fields []zapcore.Field) zapcore.Core {
+	return &zapCore{c: z.c, core: z.core.With(fields)}
+}
+
+func (z *zapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if z.c.EnableLogPrint(ent.LoggerName, FromZapLevel(ent.Level)) != LogEnable {
+		return ce
+	}
+	return z.core.Check(ent, ce)
+}
+
+func (z *zapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return z.core.Write(ent, fields)
+}
+
+func (z *zapCore) Sync() error {
+	return z.core.Sync()
+}
+
+// SyncZapAtomicLevel 将 level 设置为 partName 实际生效的日志级别，并在 configmap 更新后保持同步，返回值用于取消同步。
+// 适用于只能通过 zap.AtomicLevel 控制级别的 logger（如 zap.NewProductionConfig().Level）
+func SyncZapAtomicLevel(c LogInterface, partName string, level zap.AtomicLevel) func() {
+	level.SetLevel(ZapLevel(c.GetLogPartLevel(partName)))
+	// 上级 part、selector 或默认级别变化都可能影响 partName，因此每个事件都重新获取生效的级别
+	return c.OnLevelChange(func(LevelChangeEvent) {
+		level.SetLevel(ZapLevel(c.GetLogPartLevel(partName)))
+	})
+}
+
+// ZapLevel 返回日志级别对应的 zapcore.Level：trace 为 DebugLevel-1，debug 到 error 与 zap 一一对应，
+// fatal 为 FatalLevel，off 及更高的级别大于 FatalLevel（不打印任何日志）
+func ZapLevel(level int) zapcore.Level {
+	if level <= LogErrorLevel {
+		return zapcore.Level(level - LogInfoLevel)
+	}
+	return zapcore.FatalLevel + zapcore.Level(level-LogFatalLevel)
+}
+
+// FromZapLevel 返回 zapcore.Level 对应的日志级别，DPanicLevel、PanicLevel、FatalLevel 都对应 fatal
+func FromZapLevel(level zapcore.Level) int {
+	switch {
+	case level <= zapcore.ErrorLevel:
+		return int(level) + LogInfoLevel
+	case level <= zapcore.FatalLevel:
+		return LogFatalLevel
+	default:
+		return LogFatalLevel + int(level-zapcore.FatalLevel)
+	}
+}
@@ -0,0 +1,98 @@
+package dynamiclog
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestZapLevel(t *testing.T) {
+	for _, tc := range []struct {
+		level int
+		zap   zapcore.Level
+	}{
+		{LogTraceLevel, zapcore.DebugLevel - 1},
+		{LogDebugLevel, zapcore.DebugLevel},
+		{LogInfoLevel, zapcore.InfoLevel},
+		{LogWarnLevel, zapcore.WarnLevel},
+		{LogErrorLevel, zapcore.ErrorLevel},
+		{LogFatalLevel, zapcore.FatalLevel},
+		{LogOffLevel, zapcore.FatalLevel + 1},
+	} {
+		if got := ZapLevel(tc.level); got != tc.zap {
+			t.Errorf("ZapLevel(%d) = %v, want %v", tc.level, got, tc.zap)
+		}
+		if got := FromZapLevel(tc.zap); got != tc.level {
+			t.Errorf("FromZapLevel(%v) = %d, want %d", tc.zap, got, tc.level)
+		}
+	}
+	for _, level := range []zapcore.Level{zapcore.DPanicLevel, zapcore.PanicLevel} {
+		if got := FromZapLevel(level); got != LogFatalLevel {
+			t.Errorf("FromZapLevel(%v) = %d, want fatal", level, got)
+		}
+	}
+}
+
+func TestZapCoreFiltersByPart(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl: warn\nctl.a: trace\n")); err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(ZapLevel(LogTraceLevel))
+	logger := zap.New(NewZapCore(c, core))
+	ctl := logger.Named("ctl")
+	ctl.Info("ctl info")
+	ctl.Warn("ctl warn")
+	ctl.Named("a").Check(ZapLevel(LogTraceLevel), "ctl.a trace").Write()
+	ctl.Named("b").Info("ctl.b info")
+	ctl.With(zap.String("k", "v")).Info("ctl info with fields")
+	logger.Info("default info")
+	logger.Debug("default debug")
+
+	var got []string
+	for _, e := range logs.All() {
+		got = append(got, e.LoggerName+":"+e.Message)
+	}
+	want := []string{"ctl:ctl warn", "ctl.a:ctl.a trace", ":default info"}
+	if len(got) != len(want) {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("logged %q, want %q", got, want)
+			break
+		}
+	}
+}
+
+func TestSyncZapAtomicLevel(t *testing.T) {
+	c, indexer := newQueueTestController(t, workqueue.DefaultControllerRateLimiter())
+	updateConfigMap(t, c, indexer, newTestConfigMap("1", "ctl: warn\n"))
+	waitForLevel(t, c, "ctl", "warn")
+
+	level := zap.NewAtomicLevel()
+	cancel := SyncZapAtomicLevel(c, "ctl.a", level)
+	if got := level.Level(); got != zapcore.WarnLevel {
+		t.Errorf("level = %v, want warn inherited from ctl", got)
+	}
+	updateConfigMap(t, c, indexer, newTestConfigMap("2", "ctl: warn\nctl.a: debug\n"))
+	// 回调在发布快照之后调用
+	deadline := time.Now().Add(5 * time.Second)
+	for level.Level() != zapcore.DebugLevel {
+		if time.Now().After(deadline) {
+			t.Fatalf("level = %v after ctl.a is set to debug, want debug", level.Level())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	updateConfigMap(t, c, indexer, newTestConfigMap("3", "ctl.a: error\n"))
+	waitForLevel(t, c, "ctl.a", "error")
+	if got := level.Level(); got != zapcore.DebugLevel {
+		t.Errorf("level = %v after cancel, want debug", got)
+	}
+}
@@ -0,0 +1,53 @@
+package dynamiclog
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// zerologSampler 按 part 的动态日志级别决定是否打印日志
+type zerologSampler struct {
+	c    LogInterface
+	part string
+}
+
+// NewZerologSampler 返回按 partName 配置的日志级别过滤日志的 zerolog.Sampler。
+// zerolog 在创建 event 之前调用 Sampler，被过滤的日志没有额外开销；会替换 logger 原有的 Sampler
+func NewZerologSampler(c LogInterface, partName string) zerolog.Sampler {
+	return &zerologSampler{c: c, part: partName}
+}
+
+func (s *zerologSampler) Sample(level zerolog.Level) bool {
+	switch level {
+	case zerolog.NoLevel:
+		// logger.Log() 没有级别，总是打印
+		return true
+	case zerolog.Disabled:
+		return false
+	}
+	return s.c.EnableLogPrint(s.part, fromZerologLevel(level)) == LogEnable
+}
+
+// ZerologPart 返回带有 PartKey 字段、并按 partName 配置的日志级别过滤日志的子 logger。
+// 过滤由 dynamiclog 完成，logger 本身的级别和 zerolog.GlobalLevel 都应设置为 zerolog.TraceLevel。
+// 用法：log := dynamiclog.ZerologPart(logprint, logger, "part1")
+func ZerologPart(c LogInterface, logger zerolog.Logger, partName string) zerolog.Logger {
+	return logger.With().Str(PartKey, partName).Logger().Sample(NewZerologSampler(c, partName))
+}
+
+// fromZerologLevel 返回 zerolog.Level 对应的日志级别，PanicLevel 和 FatalLevel 都对应 fatal
+func fromZerologLevel(level zerolog.Level) int {
+	switch level {
+	case zerolog.TraceLevel:
+		return LogTraceLevel
+	case zerolog.DebugLevel:
+		return LogDebugLevel
+	case zerolog.InfoLevel:
+		return LogInfoLevel
+	case zerolog.WarnLevel:
+		return LogWarnLevel
+	case zerolog.ErrorLevel:
+		return LogErrorLevel
+	default:
+		return LogFatalLevel
+	}
+}
@@ -0,0 +1,53 @@
+package dynamiclog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFromZerologLevel(t *testing.T) {
+	for level, want := range map[zerolog.Level]int{
+		zerolog.TraceLevel: LogTraceLevel,
+		zerolog.DebugLevel: LogDebugLevel,
+		zerolog.InfoLevel:  LogInfoLevel,
+		zerolog.WarnLevel:  LogWarnLevel,
+		zerolog.ErrorLevel: LogErrorLevel,
+		zerolog.FatalLevel: LogFatalLevel,
+		zerolog.PanicLevel: LogFatalLevel,
+	} {
+		if got := fromZerologLevel(level); got != want {
+			t.Errorf("fromZerologLevel(%v) = %d, want %d", level, got, want)
+		}
+	}
+}
+
+func TestZerologPartFiltersByPart(t *testing.T) {
+	c := newTestController()
+	if err := c.parse(c.sources[0], newTestConfigMap("1", "ctl: warn\nctl.a: trace\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Level(zerolog.TraceLevel)
+
+	ctl := ZerologPart(c, logger, "ctl")
+	ctl.Info().Msg("ctl info")
+	ctl.Warn().Msg("ctl warn")
+	ctl.Log().Msg("ctl without level")
+	ctlA := ZerologPart(c, logger, "ctl.a")
+	ctlA.Trace().Msg("ctl.a trace")
+	other := ZerologPart(c, logger, "other")
+	other.Debug().Msg("default debug")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		`{"level":"warn","part":"ctl","message":"ctl warn"}`,
+		`{"part":"ctl","message":"ctl without level"}`,
+		`{"level":"trace","part":"ctl.a","message":"ctl.a trace"}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logged\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	//metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -31,8 +32,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 创建 SharedInformerFactory
+	// 创建 SharedInformerFactory，先注册 Configmap informer 再启动，factory 由调用方启动和停止
 	sharedInformerFactory := informers.NewSharedInformerFactory(clientset, time.Second*30)
+	sharedInformerFactory.Core().V1().ConfigMaps().Informer()
+	sharedInformerFactory.Start(wait.NeverStop)
 
 	// 动态日志的 Configmap 配置信息
 	cmNamespace := "default"
@@ -41,7 +44,11 @@ func main() {
 	logDefaultLevel := "info"
 
 	// 此处返回的是指针
-	logprint := dynamiclog.NewWithSharedInformerFactory(context.TODO(), sharedInformerFactory, cmNamespace, cmName, cmLogKey, logDefaultLevel)
+	logprint, err := dynamiclog.NewWithSharedInformerFactory(context.TODO(), sharedInformerFactory, cmNamespace, cmName, cmLogKey, logDefaultLevel)
+	if err != nil {
+		fmt.Printf("Error creating dynamic log controller: %v\n", err)
+		os.Exit(1)
+	}
 
 	fmt.Printf("Namespace: %s, ConfigMap: %s  --> Exist Confimap's Part-Key: %s\n", cmNamespace, cmName, logprint.GetLogPartNameList())
 	fmt.Println("Now log level setting:", logprint.GetLogPartLevelMap())